@@ -0,0 +1,273 @@
+package s3action
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	AllUsersGroup           = "http://acs.amazonaws.com/groups/global/AllUsers"
+	AuthenticatedUsersGroup = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+	LogDeliveryGroup        = "http://acs.amazonaws.com/groups/s3/LogDelivery"
+)
+
+// Grant gives one permission to one grantee. Depending on Type, the grantee
+// is identified by ID (canonical user), Email or URI (group).
+type Grant struct {
+	Type        types.Type
+	ID          string
+	Email       string
+	URI         string
+	DisplayName string
+	Permission  types.Permission
+}
+
+func GrantCanonicalUser(id string, permission types.Permission) Grant {
+	return Grant{Type: types.TypeCanonicalUser, ID: id, Permission: permission}
+}
+
+func GrantEmail(email string, permission types.Permission) Grant {
+	return Grant{Type: types.TypeAmazonCustomerByEmail, Email: email, Permission: permission}
+}
+
+func GrantGroup(uri string, permission types.Permission) Grant {
+	return Grant{Type: types.TypeGroup, URI: uri, Permission: permission}
+}
+
+// IsPublic reports whether the grant is to everyone or to any AWS account.
+func (g Grant) IsPublic() bool {
+	return g.Type == types.TypeGroup && (g.URI == AllUsersGroup || g.URI == AuthenticatedUsersGroup)
+}
+
+func (g Grant) Grantee() string {
+	switch g.Type {
+	case types.TypeGroup:
+		switch g.URI {
+		case AllUsersGroup:
+			return "EVERYONE"
+		case AuthenticatedUsersGroup:
+			return "AUTHENTICATED USERS"
+		}
+		return g.URI
+	case types.TypeAmazonCustomerByEmail:
+		return g.Email
+	}
+	if g.DisplayName != "" {
+		return g.DisplayName
+	}
+	return g.ID
+}
+
+func (g Grant) toSDK() types.Grant {
+	return types.Grant{
+		Grantee: &types.Grantee{
+			Type:         g.Type,
+			ID:           optionalString(g.ID),
+			EmailAddress: optionalString(g.Email),
+			URI:          optionalString(g.URI),
+		},
+		Permission: g.Permission,
+	}
+}
+
+func grantFromSDK(grant types.Grant) Grant {
+	g := Grant{Permission: grant.Permission}
+	if grant.Grantee != nil {
+		g.Type = grant.Grantee.Type
+		g.ID = aws.ToString(grant.Grantee.ID)
+		g.Email = aws.ToString(grant.Grantee.EmailAddress)
+		g.URI = aws.ToString(grant.Grantee.URI)
+		g.DisplayName = aws.ToString(grant.Grantee.DisplayName)
+	}
+	return g
+}
+
+type AccessControlList struct {
+	OwnerID          string
+	OwnerDisplayName string
+	Grants           []Grant
+}
+
+func (a *AccessControlList) PublicGrants() []Grant {
+	var public []Grant
+	for _, g := range a.Grants {
+		if g.IsPublic() {
+			public = append(public, g)
+		}
+	}
+	return public
+}
+
+func newAccessControlList(owner *types.Owner, grants []types.Grant) *AccessControlList {
+	acl := &AccessControlList{}
+	if owner != nil {
+		acl.OwnerID = aws.ToString(owner.ID)
+		acl.OwnerDisplayName = aws.ToString(owner.DisplayName)
+	}
+	for _, grant := range grants {
+		acl.Grants = append(acl.Grants, grantFromSDK(grant))
+	}
+	return acl
+}
+
+func (a *AccessControlList) toSDK() *types.AccessControlPolicy {
+	policy := &types.AccessControlPolicy{
+		Owner: &types.Owner{ID: aws.String(a.OwnerID), DisplayName: optionalString(a.OwnerDisplayName)},
+	}
+	for _, g := range a.Grants {
+		policy.Grants = append(policy.Grants, g.toSDK())
+	}
+	return policy
+}
+
+func validateGrants(grants []Grant) error {
+	for i, g := range grants {
+		switch {
+		case g.Type == types.TypeCanonicalUser && g.ID == "",
+			g.Type == types.TypeAmazonCustomerByEmail && g.Email == "",
+			g.Type == types.TypeGroup && g.URI == "":
+			return fmt.Errorf("grant %d has no grantee for type %v", i, g.Type)
+		case g.Type == "":
+			return fmt.Errorf("grant %d has no grantee type", i)
+		case g.Permission == "":
+			return fmt.Errorf("grant %d has no permission", i)
+		}
+	}
+	return nil
+}
+
+func hasPublicGrant(grants []Grant) bool {
+	for _, g := range grants {
+		if g.IsPublic() {
+			return true
+		}
+	}
+	return false
+}
+
+func isPublicCannedAcl(acl string) bool {
+	switch acl {
+	case string(types.ObjectCannedACLPublicRead), string(types.ObjectCannedACLPublicReadWrite),
+		string(types.ObjectCannedACLAuthenticatedRead):
+		return true
+	}
+	return false
+}
+
+func (s *S3Base) GetBucketAcl(bucketName string) (*AccessControlList, error) {
+	output, err := s.S3Client.GetBucketAcl(context.TODO(), &s3.GetBucketAclInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		log.Printf("Couldn't get ACL of bucket %v. Here's why: %v\n", bucketName, err)
+		return nil, err
+	}
+	return newAccessControlList(output.Owner, output.Grants), nil
+}
+
+func (s *S3Base) GetObjectAcl(bucketName, objectKey string) (*AccessControlList, error) {
+	return s.getObjectAcl(context.TODO(), bucketName, objectKey)
+}
+
+func (s *S3Base) getObjectAcl(ctx context.Context, bucketName, objectKey string) (*AccessControlList, error) {
+	output, err := s.S3Client.GetObjectAcl(ctx, &s3.GetObjectAclInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		log.Printf("Couldn't get ACL of object %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+		return nil, err
+	}
+	return newAccessControlList(output.Owner, output.Grants), nil
+}
+
+// PutBucketCannedAcl applies a canned ACL. Public ACLs are checked against
+// ownership controls and block public access first.
+func (s *S3Base) PutBucketCannedAcl(bucketName string, acl types.BucketCannedACL, opts ...PublicAclOption) error {
+	if isPublicCannedAcl(string(acl)) {
+		if err := s.preparePublicAcl(bucketName, opts); err != nil {
+			return err
+		}
+	}
+	_, err := s.S3Client.PutBucketAcl(context.TODO(), &s3.PutBucketAclInput{
+		Bucket: aws.String(bucketName),
+		ACL:    acl,
+	})
+	if err != nil {
+		log.Printf("Couldn't put ACL %v on bucket %v. Here's why: %v\n", acl, bucketName, err)
+	}
+	return err
+}
+
+func (s *S3Base) PutObjectCannedAcl(bucketName, objectKey string, acl types.ObjectCannedACL, opts ...PublicAclOption) error {
+	if isPublicCannedAcl(string(acl)) {
+		if err := s.preparePublicAcl(bucketName, opts); err != nil {
+			return err
+		}
+	}
+	_, err := s.S3Client.PutObjectAcl(context.TODO(), &s3.PutObjectAclInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectKey),
+		ACL:    acl,
+	})
+	if err != nil {
+		log.Printf("Couldn't put ACL %v on object %v:%v. Here's why: %v\n", acl, bucketName, objectKey, err)
+	}
+	return err
+}
+
+// PutBucketGrants replaces the bucket ACL with grants, keeping the current
+// owner. Include a FULL_CONTROL grant for the owner to keep owner access.
+func (s *S3Base) PutBucketGrants(bucketName string, grants []Grant, opts ...PublicAclOption) error {
+	if err := validateGrants(grants); err != nil {
+		return err
+	}
+	if hasPublicGrant(grants) {
+		if err := s.preparePublicAcl(bucketName, opts); err != nil {
+			return err
+		}
+	}
+	current, err := s.GetBucketAcl(bucketName)
+	if err != nil {
+		return err
+	}
+	current.Grants = grants
+	_, err = s.S3Client.PutBucketAcl(context.TODO(), &s3.PutBucketAclInput{
+		Bucket:              aws.String(bucketName),
+		AccessControlPolicy: current.toSDK(),
+	})
+	if err != nil {
+		log.Printf("Couldn't put grants on bucket %v. Here's why: %v\n", bucketName, err)
+	}
+	return err
+}
+
+func (s *S3Base) PutObjectGrants(bucketName, objectKey string, grants []Grant, opts ...PublicAclOption) error {
+	if err := validateGrants(grants); err != nil {
+		return err
+	}
+	if hasPublicGrant(grants) {
+		if err := s.preparePublicAcl(bucketName, opts); err != nil {
+			return err
+		}
+	}
+	current, err := s.GetObjectAcl(bucketName, objectKey)
+	if err != nil {
+		return err
+	}
+	current.Grants = grants
+	_, err = s.S3Client.PutObjectAcl(context.TODO(), &s3.PutObjectAclInput{
+		Bucket:              aws.String(bucketName),
+		Key:                 aws.String(objectKey),
+		AccessControlPolicy: current.toSDK(),
+	})
+	if err != nil {
+		log.Printf("Couldn't put grants on object %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+	}
+	return err
+}
@@ -0,0 +1,368 @@
+package s3action
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type Severity int
+
+const (
+	SeverityLow Severity = iota
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityCritical:
+		return "CRITICAL"
+	case SeverityHigh:
+		return "HIGH"
+	case SeverityMedium:
+		return "MEDIUM"
+	}
+	return "LOW"
+}
+
+type ExposureSource string
+
+const (
+	SourceBucketAcl         ExposureSource = "bucket-acl"
+	SourceObjectAcl         ExposureSource = "object-acl"
+	SourceBucketPolicy      ExposureSource = "bucket-policy"
+	SourcePublicAccessBlock ExposureSource = "public-access-block"
+)
+
+// ExposureFinding is one way a bucket or object can be read or written by
+// AllUsers or AuthenticatedUsers. Key is empty for bucket level findings.
+type ExposureFinding struct {
+	Bucket      string
+	Key         string
+	Source      ExposureSource
+	Grantee     string
+	Access      string
+	Severity    Severity
+	Description string
+	Remediation string
+}
+
+func (f ExposureFinding) String() string {
+	target := f.Bucket
+	if f.Key != "" {
+		target += "/" + f.Key
+	}
+	return fmt.Sprintf("[%v] %v (%v): %v. Fix: %v", f.Severity, target, f.Source, f.Description, f.Remediation)
+}
+
+type ExposureReport struct {
+	Findings       []ExposureFinding
+	ObjectsChecked int
+	Errors         map[string]error
+}
+
+func (r *ExposureReport) HighestSeverity() (Severity, bool) {
+	if len(r.Findings) == 0 {
+		return SeverityLow, false
+	}
+	return r.Findings[0].Severity, true
+}
+
+func (r *ExposureReport) AtLeast(severity Severity) []ExposureFinding {
+	var findings []ExposureFinding
+	for _, f := range r.Findings {
+		if f.Severity >= severity {
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+func (r *ExposureReport) sort() {
+	sort.SliceStable(r.Findings, func(i, j int) bool {
+		a, b := r.Findings[i], r.Findings[j]
+		if a.Severity != b.Severity {
+			return a.Severity > b.Severity
+		}
+		if a.Bucket != b.Bucket {
+			return a.Bucket < b.Bucket
+		}
+		return a.Key < b.Key
+	})
+}
+
+// AuditOptions limits the audit. With ObjectSampleSize set, only the first
+// objects under Prefix in each bucket have their ACLs checked; ScanAllObjects
+// checks every object instead.
+type AuditOptions struct {
+	Buckets          []string
+	Prefix           string
+	ObjectSampleSize int
+	ScanAllObjects   bool
+	MaxParallel      int
+}
+
+var writePermissions = map[types.Permission]bool{
+	types.PermissionWrite:       true,
+	types.PermissionWriteAcp:    true,
+	types.PermissionFullControl: true,
+}
+
+// AclExposure returns findings for the public grants in acl. Key is empty
+// for a bucket ACL. Grants neutralised by IgnorePublicAcls are reported as
+// low severity.
+func AclExposure(bucketName, objectKey string, acl *AccessControlList, block PublicAccessBlock) []ExposureFinding {
+	source, target, fix := SourceBucketAcl, "bucket", "PutBucketCannedAcl(bucket, private)"
+	if objectKey != "" {
+		source, target, fix = SourceObjectAcl, "object", "PutObjectCannedAcl(bucket, key, private)"
+	}
+
+	var findings []ExposureFinding
+	for _, g := range acl.PublicGrants() {
+		var severity Severity
+		switch {
+		case writePermissions[g.Permission]:
+			severity = SeverityCritical
+		case g.Permission == types.PermissionRead:
+			severity = SeverityHigh
+		default:
+			severity = SeverityMedium
+		}
+		if g.URI == AuthenticatedUsersGroup && severity > SeverityMedium {
+			severity--
+		}
+		finding := ExposureFinding{
+			Bucket:      bucketName,
+			Key:         objectKey,
+			Source:      source,
+			Grantee:     g.Grantee(),
+			Access:      string(g.Permission),
+			Severity:    severity,
+			Description: fmt.Sprintf("%v ACL grants %v to %v", target, g.Permission, g.Grantee()),
+			Remediation: fmt.Sprintf("remove the grant with %v, or enable BlockPublicAcls and IgnorePublicAcls", fix),
+		}
+		if block.IgnorePublicAcls {
+			finding.Severity = SeverityLow
+			finding.Description += ", but IgnorePublicAcls makes it ineffective"
+			finding.Remediation = fmt.Sprintf("remove the stale grant with %v", fix)
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+var policyWriteActions = []string{
+	"s3:PutObject", "s3:DeleteObject", "s3:PutObjectAcl", "s3:PutBucketPolicy",
+	"s3:PutBucketAcl", "s3:DeleteBucket", "s3:DeleteBucketPolicy",
+}
+
+var policyReadActions = []string{"s3:GetObject", "s3:ListBucket", "s3:GetObjectVersion"}
+
+// PolicyExposure returns findings for Allow statements that apply to any
+// principal. Statements with conditions are reported at medium severity,
+// since the condition may restrict them to a network or account. An Allow
+// with NotPrincipal grants everyone except the listed principals and is
+// reported at high severity or above, whatever its conditions.
+func PolicyExposure(bucketName string, policy *PolicyDocument, block PublicAccessBlock) []ExposureFinding {
+	var findings []ExposureFinding
+	for i, st := range policy.Statement {
+		allExcept := st.NotPrincipal != nil
+		if st.Effect != EffectAllow || !(allExcept || isPublicPrincipal(st.Principal)) {
+			continue
+		}
+		matchesAny := func(actions []string) []string {
+			var matched []string
+			for _, action := range actions {
+				allowed := anyWildcardMatch(st.Action, action, true)
+				if len(st.NotAction) > 0 {
+					allowed = !anyWildcardMatch(st.NotAction, action, true)
+				}
+				if allowed {
+					matched = append(matched, action)
+				}
+			}
+			return matched
+		}
+
+		severity, actions := SeverityHigh, matchesAny(policyWriteActions)
+		if len(actions) > 0 {
+			severity = SeverityCritical
+		} else if actions = matchesAny(policyReadActions); len(actions) == 0 {
+			severity, actions = SeverityMedium, st.Action
+		}
+		name := st.Sid
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		}
+		finding := ExposureFinding{
+			Bucket:      bucketName,
+			Source:      SourceBucketPolicy,
+			Grantee:     "*",
+			Access:      fmt.Sprint(actions),
+			Severity:    severity,
+			Description: fmt.Sprintf("policy statement %v allows %v to any principal", name, actions),
+			Remediation: "restrict the statement Principal to specific accounts, or enable BlockPublicPolicy and RestrictPublicBuckets",
+		}
+		if allExcept {
+			if finding.Severity < SeverityHigh {
+				finding.Severity = SeverityHigh
+			}
+			finding.Grantee = "* except NotPrincipal"
+			finding.Description = fmt.Sprintf("policy statement %v allows %v to every principal not in NotPrincipal", name, actions)
+			finding.Remediation = "replace NotPrincipal with a Principal that lists the accounts to allow"
+		} else if len(st.Condition) > 0 && finding.Severity > SeverityMedium {
+			finding.Severity = SeverityMedium
+			finding.Description += " under conditions"
+			finding.Remediation = "check that the statement conditions limit access to trusted sources"
+		}
+		if block.RestrictPublicBuckets {
+			finding.Severity = SeverityLow
+			finding.Description += ", but RestrictPublicBuckets limits it to AWS services and the bucket owner"
+			finding.Remediation = "remove the public statement from the policy"
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+func isPublicPrincipal(p *Principal) bool {
+	if p == nil {
+		return false
+	}
+	if p.All {
+		return true
+	}
+	for _, arn := range p.AWS {
+		if arn == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func publicAccessBlockExposure(bucketName string, block PublicAccessBlock) []ExposureFinding {
+	if block == BlockAllPublicAccess() {
+		return nil
+	}
+	return []ExposureFinding{{
+		Bucket:      bucketName,
+		Source:      SourcePublicAccessBlock,
+		Severity:    SeverityLow,
+		Description: fmt.Sprintf("block public access is not fully enabled (%+v)", block),
+		Remediation: "call PutPublicAccessBlock(bucket, BlockAllPublicAccess()) unless the bucket must be public",
+	}}
+}
+
+// AuditPublicExposure inspects every bucket in the account, or only
+// opts.Buckets, and reports what AllUsers or AuthenticatedUsers can read or
+// write, most severe first. Buckets that can't be inspected are recorded in
+// Errors and skipped.
+func (s *S3Base) AuditPublicExposure(ctx context.Context, opts AuditOptions) (*ExposureReport, error) {
+	bucketNames := opts.Buckets
+	if len(bucketNames) == 0 {
+		buckets, err := s.GetBucketList()
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range buckets {
+			bucketNames = append(bucketNames, aws.ToString(b.Name))
+		}
+	}
+
+	// Each bucket is audited through a client for its own region, since
+	// requests sent to another region are rejected.
+	report := &ExposureReport{Errors: map[string]error{}}
+	clients := map[string]*S3Base{}
+	for _, bucketName := range bucketNames {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		region, err := s.GetBucketRegion(bucketName)
+		if err != nil {
+			report.Errors[bucketName] = err
+			continue
+		}
+		client, ok := clients[region]
+		if !ok {
+			client = s.ForRegion(region)
+			clients[region] = client
+		}
+		findings, checked, err := client.auditBucket(ctx, bucketName, opts)
+		report.Findings = append(report.Findings, findings...)
+		report.ObjectsChecked += checked
+		if err != nil {
+			report.Errors[bucketName] = err
+		}
+	}
+	report.sort()
+	log.Printf("Audited %d buckets and %d objects: %d findings, %d errors\n",
+		len(bucketNames), report.ObjectsChecked, len(report.Findings), len(report.Errors))
+	return report, nil
+}
+
+func (s *S3Base) auditBucket(ctx context.Context, bucketName string, opts AuditOptions) ([]ExposureFinding, int, error) {
+	block, err := s.GetPublicAccessBlock(bucketName)
+	if err != nil {
+		return nil, 0, err
+	}
+	findings := publicAccessBlockExposure(bucketName, block)
+
+	acl, err := s.GetBucketAcl(bucketName)
+	if err != nil {
+		return findings, 0, err
+	}
+	findings = append(findings, AclExposure(bucketName, "", acl, block)...)
+
+	// A bucket without a policy has nothing to add.
+	policy, err := s.GetBucketPolicy(bucketName)
+	switch {
+	case err == nil:
+		findings = append(findings, PolicyExposure(bucketName, policy, block)...)
+	case apiErrorCode(err) != "NoSuchBucketPolicy":
+		return findings, 0, err
+	}
+
+	if opts.ObjectSampleSize <= 0 && !opts.ScanAllObjects {
+		return findings, 0, nil
+	}
+	objects, err := s.auditObjectList(ctx, bucketName, opts)
+	if err != nil {
+		return findings, 0, err
+	}
+	var mu sync.Mutex
+	_, _, err = RunBatch(ctx, objects, BatchOptions{MaxParallel: opts.MaxParallel}, func(ctx context.Context, object types.Object) error {
+		acl, err := s.getObjectAcl(ctx, bucketName, aws.ToString(object.Key))
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		findings = append(findings, AclExposure(bucketName, aws.ToString(object.Key), acl, block)...)
+		mu.Unlock()
+		return nil
+	})
+	return findings, len(objects), err
+}
+
+func (s *S3Base) auditObjectList(ctx context.Context, bucketName string, opts AuditOptions) ([]types.Object, error) {
+	if opts.ScanAllObjects {
+		return s.getObjectListByPrefix(ctx, bucketName, opts.Prefix)
+	}
+	output, err := s.S3Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucketName),
+		Prefix:  optionalString(opts.Prefix),
+		MaxKeys: int32(opts.ObjectSampleSize),
+	})
+	if err != nil {
+		log.Printf("Couldn't list objects in bucket %v. Here's why: %v\n", bucketName, err)
+		return nil, err
+	}
+	return output.Contents, nil
+}
@@ -0,0 +1,184 @@
+package s3action
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type BatchMode int
+
+const (
+	ContinueOnError BatchMode = iota
+	FailFast
+)
+
+var ErrBatchSkipped = errors.New("batch item skipped")
+
+type BatchOptions struct {
+	MaxParallel int
+	Mode        BatchMode
+}
+
+type BatchResult[T any] struct {
+	Index    int
+	Item     T
+	Err      error
+	Duration time.Duration
+}
+
+type BatchStats struct {
+	Total     int
+	Succeeded int
+	Failed    int
+	Skipped   int
+	Elapsed   time.Duration
+}
+
+// RunBatch calls fn for every item with at most MaxParallel calls in flight.
+// Items that were never started because of FailFast or a cancelled context
+// are reported with an error wrapping ErrBatchSkipped. The returned error is
+// the first failure, if any.
+func RunBatch[T any](ctx context.Context, items []T, opts BatchOptions, fn func(ctx context.Context, item T) error) ([]BatchResult[T], BatchStats, error) {
+	maxParallel := opts.MaxParallel
+	if maxParallel <= 0 {
+		maxParallel = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	start := time.Now()
+	results := make([]BatchResult[T], len(items))
+	sem := make(chan struct{}, maxParallel)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	for i, item := range items {
+		results[i] = BatchResult[T]{Index: i, Item: item}
+		select {
+		case <-ctx.Done():
+			results[i].Err = skippedErr(ctx)
+			continue
+		case sem <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			<-sem
+			results[i].Err = skippedErr(ctx)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, item T) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			itemStart := time.Now()
+			err := fn(ctx, item)
+			results[i].Err = err
+			results[i].Duration = time.Since(itemStart)
+			if err != nil {
+				once.Do(func() { firstErr = err })
+				if opts.Mode == FailFast {
+					cancel()
+				}
+			}
+		}(i, item)
+	}
+	wg.Wait()
+
+	stats := BatchStats{Total: len(items), Elapsed: time.Since(start)}
+	for _, r := range results {
+		switch {
+		case r.Err == nil:
+			stats.Succeeded++
+		case errors.Is(r.Err, ErrBatchSkipped):
+			stats.Skipped++
+		default:
+			stats.Failed++
+		}
+	}
+	if firstErr == nil && stats.Skipped > 0 {
+		firstErr = skippedErr(ctx)
+	}
+	return results, stats, firstErr
+}
+
+func skippedErr(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return &batchSkippedError{cause: err}
+	}
+	return ErrBatchSkipped
+}
+
+type batchSkippedError struct {
+	cause error
+}
+
+func (e *batchSkippedError) Error() string {
+	return ErrBatchSkipped.Error() + ": " + e.cause.Error()
+}
+
+func (e *batchSkippedError) Is(target error) bool {
+	return target == ErrBatchSkipped
+}
+
+func (e *batchSkippedError) Unwrap() error {
+	return e.cause
+}
+
+type UploadItem struct {
+	ObjectKey string
+	FileName  string
+}
+
+type DownloadItem struct {
+	ObjectKey string
+	FileName  string
+}
+
+type CopyItem struct {
+	SourceBucket string
+	SourceKey    string
+	ObjectKey    string
+}
+
+func (s *S3Base) BatchUpload(ctx context.Context, bucketName string, items []UploadItem, opts BatchOptions) ([]BatchResult[UploadItem], BatchStats, error) {
+	results, stats, err := RunBatch(ctx, items, opts, func(ctx context.Context, item UploadItem) error {
+		return s.uploadFile(ctx, bucketName, item.ObjectKey, item.FileName)
+	})
+	logBatchStats("upload", bucketName, stats)
+	return results, stats, err
+}
+
+func (s *S3Base) BatchDownload(ctx context.Context, bucketName string, items []DownloadItem, opts BatchOptions) ([]BatchResult[DownloadItem], BatchStats, error) {
+	results, stats, err := RunBatch(ctx, items, opts, func(ctx context.Context, item DownloadItem) error {
+		return s.downloadFile(ctx, bucketName, item.ObjectKey, item.FileName)
+	})
+	logBatchStats("download", bucketName, stats)
+	return results, stats, err
+}
+
+func (s *S3Base) BatchDelete(ctx context.Context, bucketName string, objects []types.Object, opts BatchOptions) ([]BatchResult[types.Object], BatchStats, error) {
+	results, stats, err := RunBatch(ctx, objects, opts, func(ctx context.Context, object types.Object) error {
+		return s.deleteObject(ctx, bucketName, object)
+	})
+	logBatchStats("delete", bucketName, stats)
+	return results, stats, err
+}
+
+func (s *S3Base) BatchCopy(ctx context.Context, bucketName string, items []CopyItem, opts BatchOptions) ([]BatchResult[CopyItem], BatchStats, error) {
+	results, stats, err := RunBatch(ctx, items, opts, func(ctx context.Context, item CopyItem) error {
+		return s.copyObject(ctx, item.SourceBucket, item.SourceKey, bucketName, item.ObjectKey)
+	})
+	logBatchStats("copy", bucketName, stats)
+	return results, stats, err
+}
+
+func logBatchStats(action, bucketName string, stats BatchStats) {
+	log.Printf("Batch %v on bucket %v finished in %v: %d succeeded, %d failed, %d skipped of %d\n",
+		action, bucketName, stats.Elapsed, stats.Succeeded, stats.Failed, stats.Skipped, stats.Total)
+}
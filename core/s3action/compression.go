@@ -0,0 +1,142 @@
+package s3action
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/klauspost/compress/zstd"
+)
+
+type Compression string
+
+const (
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+
+	originalSizeMetadata = "original-size"
+)
+
+// CompressionPolicy decides which uploads are compressed. Keys whose
+// extension is in SkipExtensions are uploaded as is.
+type CompressionPolicy struct {
+	Algorithm      Compression
+	SkipExtensions []string
+}
+
+func DefaultCompressionPolicy(algorithm Compression) CompressionPolicy {
+	return CompressionPolicy{
+		Algorithm: algorithm,
+		SkipExtensions: []string{
+			".gz", ".tgz", ".zst", ".zip", ".bz2", ".xz", ".7z", ".br",
+			".jpg", ".jpeg", ".png", ".gif", ".webp", ".mp3", ".mp4", ".mov",
+		},
+	}
+}
+
+func (p CompressionPolicy) ShouldCompress(objectKey string) bool {
+	ext := strings.ToLower(filepath.Ext(objectKey))
+	for _, skip := range p.SkipExtensions {
+		if ext == skip {
+			return false
+		}
+	}
+	return true
+}
+
+func WithCompression(policy CompressionPolicy) PutOption {
+	return func(o *PutOptions) {
+		o.Compression = &policy
+	}
+}
+
+func newCompressWriter(algorithm Compression, w io.Writer) (io.WriteCloser, error) {
+	switch algorithm {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", algorithm)
+	}
+}
+
+// decompressBody wraps body according to the object's Content-Encoding.
+// Bodies with any other encoding are returned unchanged.
+func decompressBody(contentEncoding *string, body io.ReadCloser) (io.ReadCloser, error) {
+	if contentEncoding == nil {
+		return body, nil
+	}
+	switch Compression(strings.ToLower(*contentEncoding)) {
+	case CompressionGzip:
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return &decompressReadCloser{Reader: reader, closers: []io.Closer{reader, body}}, nil
+	case CompressionZstd:
+		decoder, err := zstd.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return &decompressReadCloser{Reader: decoder, closers: []io.Closer{decoder.IOReadCloser(), body}}, nil
+	default:
+		return body, nil
+	}
+}
+
+type decompressReadCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *decompressReadCloser) Close() error {
+	var err error
+	for _, closer := range r.closers {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// uploadCompressed streams body through the compressor into the multipart
+// uploader, so the compressed size never has to be known up front.
+func (s *S3Base) uploadCompressed(ctx context.Context, input *s3.PutObjectInput, body io.Reader, size int64, algorithm Compression) error {
+	pr, pw := io.Pipe()
+	writer, err := newCompressWriter(algorithm, pw)
+	if err != nil {
+		return err
+	}
+	go func() {
+		_, err := io.Copy(writer, body)
+		if closeErr := writer.Close(); err == nil {
+			err = closeErr
+		}
+		pw.CloseWithError(err)
+	}()
+
+	input.Body = pr
+	input.ContentEncoding = aws.String(string(algorithm))
+	if input.Metadata == nil {
+		input.Metadata = map[string]string{}
+	}
+	input.Metadata[originalSizeMetadata] = strconv.FormatInt(size, 10)
+
+	uploader := manager.NewUploader(s.S3Client)
+	_, err = uploader.Upload(ctx, input)
+	pr.CloseWithError(err)
+	if err != nil {
+		log.Printf("Couldn't upload %v compressed object to %v:%v. Here's why: %v\n",
+			algorithm, *input.Bucket, *input.Key, err)
+	}
+	return err
+}
@@ -0,0 +1,248 @@
+package s3action
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const maxCORSRules = 100
+
+var corsMethods = map[string]bool{"GET": true, "PUT": true, "POST": true, "DELETE": true, "HEAD": true}
+
+type CORSRule struct {
+	ID             string
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	ExposeHeaders  []string
+	MaxAgeSeconds  int32
+}
+
+func NewCORSRule(origins ...string) *CORSRule {
+	return &CORSRule{AllowedOrigins: origins}
+}
+
+func (r *CORSRule) WithID(id string) *CORSRule {
+	r.ID = id
+	return r
+}
+
+func (r *CORSRule) AllowMethods(methods ...string) *CORSRule {
+	r.AllowedMethods = append(r.AllowedMethods, methods...)
+	return r
+}
+
+func (r *CORSRule) AllowHeaders(headers ...string) *CORSRule {
+	r.AllowedHeaders = append(r.AllowedHeaders, headers...)
+	return r
+}
+
+func (r *CORSRule) Expose(headers ...string) *CORSRule {
+	r.ExposeHeaders = append(r.ExposeHeaders, headers...)
+	return r
+}
+
+func (r *CORSRule) MaxAge(d time.Duration) *CORSRule {
+	r.MaxAgeSeconds = int32(d / time.Second)
+	return r
+}
+
+// BrowserUploadRule allows the PUT, POST and GET requests a browser upload
+// page sends, exposing the ETag header that multipart uploads need.
+func BrowserUploadRule(origins ...string) *CORSRule {
+	return NewCORSRule(origins...).
+		AllowMethods("GET", "PUT", "POST").
+		AllowHeaders("*").
+		Expose("ETag").
+		MaxAge(time.Hour)
+}
+
+func ValidateCORSRules(rules []CORSRule) error {
+	if len(rules) == 0 {
+		return fmt.Errorf("no CORS rules")
+	}
+	if len(rules) > maxCORSRules {
+		return fmt.Errorf("%d CORS rules exceed the limit of %d", len(rules), maxCORSRules)
+	}
+	for i, r := range rules {
+		if len(r.AllowedOrigins) == 0 || len(r.AllowedMethods) == 0 {
+			return fmt.Errorf("CORS rule %d needs at least one origin and method", i)
+		}
+		for _, m := range r.AllowedMethods {
+			if !corsMethods[m] {
+				return fmt.Errorf("CORS rule %d: unsupported method %q", i, m)
+			}
+		}
+		for _, list := range [][]string{r.AllowedOrigins, r.AllowedHeaders} {
+			for _, v := range list {
+				if strings.Count(v, "*") > 1 {
+					return fmt.Errorf("CORS rule %d: %q has more than one wildcard", i, v)
+				}
+			}
+		}
+		if r.MaxAgeSeconds < 0 {
+			return fmt.Errorf("CORS rule %d: negative max age", i)
+		}
+	}
+	return nil
+}
+
+// GetBucketCors returns nil if the bucket has no CORS configuration.
+func (s *S3Base) GetBucketCors(bucketName string) ([]CORSRule, error) {
+	output, err := s.S3Client.GetBucketCors(context.TODO(), &s3.GetBucketCorsInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		if apiErrorCode(err) == "NoSuchCORSConfiguration" {
+			return nil, nil
+		}
+		log.Printf("Couldn't get CORS of bucket %v. Here's why: %v\n", bucketName, err)
+		return nil, err
+	}
+	rules := make([]CORSRule, len(output.CORSRules))
+	for i, r := range output.CORSRules {
+		rules[i] = CORSRule{
+			ID:             aws.ToString(r.ID),
+			AllowedOrigins: r.AllowedOrigins,
+			AllowedMethods: r.AllowedMethods,
+			AllowedHeaders: r.AllowedHeaders,
+			ExposeHeaders:  r.ExposeHeaders,
+			MaxAgeSeconds:  r.MaxAgeSeconds,
+		}
+	}
+	return rules, nil
+}
+
+func (s *S3Base) PutBucketCors(bucketName string, rules []CORSRule) error {
+	if err := ValidateCORSRules(rules); err != nil {
+		return err
+	}
+	corsRules := make([]types.CORSRule, len(rules))
+	for i, r := range rules {
+		corsRules[i] = types.CORSRule{
+			ID:             optionalString(r.ID),
+			AllowedOrigins: r.AllowedOrigins,
+			AllowedMethods: r.AllowedMethods,
+			AllowedHeaders: r.AllowedHeaders,
+			ExposeHeaders:  r.ExposeHeaders,
+			MaxAgeSeconds:  r.MaxAgeSeconds,
+		}
+	}
+	_, err := s.S3Client.PutBucketCors(context.TODO(), &s3.PutBucketCorsInput{
+		Bucket:            aws.String(bucketName),
+		CORSConfiguration: &types.CORSConfiguration{CORSRules: corsRules},
+	})
+	if err != nil {
+		log.Printf("Couldn't put CORS on bucket %v. Here's why: %v\n", bucketName, err)
+	}
+	return err
+}
+
+func (s *S3Base) DeleteBucketCors(bucketName string) error {
+	_, err := s.S3Client.DeleteBucketCors(context.TODO(), &s3.DeleteBucketCorsInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		log.Printf("Couldn't delete CORS of bucket %v. Here's why: %v\n", bucketName, err)
+	}
+	return err
+}
+
+// PreflightRequest is a browser OPTIONS request: the Origin header, the
+// Access-Control-Request-Method and the Access-Control-Request-Headers.
+type PreflightRequest struct {
+	Origin  string
+	Method  string
+	Headers []string
+}
+
+type CORSRuleTrace struct {
+	Index   int
+	ID      string
+	Matched bool
+	Reason  string
+}
+
+// PreflightResult holds the Access-Control-* response headers S3 would
+// send for an allowed preflight, and the first matching rule.
+type PreflightResult struct {
+	Allowed       bool
+	RuleIndex     int
+	AllowOrigin   string
+	AllowMethods  []string
+	AllowHeaders  []string
+	ExposeHeaders []string
+	MaxAgeSeconds int32
+	Trace         []CORSRuleTrace
+}
+
+// EvaluateCORSPreflight checks req against rules the way S3 does: the first
+// rule whose origin, method and every requested header match is used.
+func EvaluateCORSPreflight(rules []CORSRule, req PreflightRequest) PreflightResult {
+	result := PreflightResult{RuleIndex: -1}
+	for i, r := range rules {
+		reason := corsRuleMismatch(r, req)
+		result.Trace = append(result.Trace, CORSRuleTrace{Index: i, ID: r.ID, Matched: reason == "", Reason: reason})
+		if reason != "" {
+			continue
+		}
+		result.Allowed = true
+		result.RuleIndex = i
+		result.AllowOrigin = req.Origin
+		if len(r.AllowedOrigins) == 1 && r.AllowedOrigins[0] == "*" {
+			result.AllowOrigin = "*"
+		}
+		result.AllowMethods = r.AllowedMethods
+		result.AllowHeaders = req.Headers
+		result.ExposeHeaders = r.ExposeHeaders
+		result.MaxAgeSeconds = r.MaxAgeSeconds
+		result.Trace[i].Reason = "matched"
+		break
+	}
+	return result
+}
+
+func corsRuleMismatch(r CORSRule, req PreflightRequest) string {
+	if !corsAnyMatch(r.AllowedOrigins, req.Origin, false) {
+		return fmt.Sprintf("origin %v is not allowed", req.Origin)
+	}
+	if !corsAnyMatch(r.AllowedMethods, req.Method, false) {
+		return fmt.Sprintf("method %v is not allowed", req.Method)
+	}
+	for _, header := range req.Headers {
+		if !corsAnyMatch(r.AllowedHeaders, strings.TrimSpace(header), true) {
+			return fmt.Sprintf("header %v is not allowed", header)
+		}
+	}
+	return ""
+}
+
+// corsAnyMatch matches value against patterns that may contain a single *.
+func corsAnyMatch(patterns []string, value string, ignoreCase bool) bool {
+	if ignoreCase {
+		value = strings.ToLower(value)
+	}
+	for _, pattern := range patterns {
+		if ignoreCase {
+			pattern = strings.ToLower(pattern)
+		}
+		prefix, suffix, wildcard := strings.Cut(pattern, "*")
+		if !wildcard {
+			if pattern == value {
+				return true
+			}
+			continue
+		}
+		if len(value) >= len(prefix)+len(suffix) && strings.HasPrefix(value, prefix) && strings.HasSuffix(value, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,371 @@
+package s3action
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// MaxTextDiffSize is the largest object DiffVersions renders as a text diff.
+// Larger objects are compared like binary ones.
+const MaxTextDiffSize = 1 << 20
+
+const (
+	diffContextLines = 3
+	maxLcsCells      = 1 << 22
+)
+
+type FieldChange struct {
+	Field string
+	From  string
+	To    string
+}
+
+// VersionDiff compares two versions of one object. Unified is only set for
+// text objects; Changes lists the differing size, checksum and metadata
+// fields for both kinds. The SHA-256 fields stay empty when matching ETags
+// already show the content is the same.
+type VersionDiff struct {
+	Bucket     string
+	Key        string
+	From       *ObjectInfo
+	To         *ObjectInfo
+	FromSHA256 string
+	ToSHA256   string
+	Binary     bool
+	Changes    []FieldChange
+	Unified    string
+}
+
+func (d *VersionDiff) Identical() bool {
+	return len(d.Changes) == 0
+}
+
+func (d *VersionDiff) String() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "s3://%s/%s %s..%s\n", d.Bucket, d.Key, d.From.VersionId, d.To.VersionId)
+	if d.Identical() {
+		buf.WriteString("versions are identical\n")
+		return buf.String()
+	}
+	for _, c := range d.Changes {
+		fmt.Fprintf(&buf, "%s: %s -> %s\n", c.Field, c.From, c.To)
+	}
+	if d.Binary && d.FromSHA256 != d.ToSHA256 {
+		buf.WriteString("binary content differs\n")
+	}
+	buf.WriteString(d.Unified)
+	return buf.String()
+}
+
+// DiffVersions compares two versions of an object. Both are stat'ed first:
+// versions with the same ETag and size are treated as identical without
+// reading them. Otherwise the bodies are streamed through SHA-256, and only
+// text objects up to MaxTextDiffSize are kept in memory for the unified diff.
+func (s *S3Base) DiffVersions(bucketName, objectKey, fromVersion, toVersion string, opts ...GetOption) (*VersionDiff, error) {
+	diff := &VersionDiff{Bucket: bucketName, Key: objectKey}
+	var err error
+	if diff.From, err = s.StatObjectByVersion(bucketName, objectKey, fromVersion, opts...); err != nil {
+		return nil, err
+	}
+	if diff.To, err = s.StatObjectByVersion(bucketName, objectKey, toVersion, opts...); err != nil {
+		return nil, err
+	}
+	diff.Changes = compareObjectInfo(diff.From, diff.To)
+	diff.Binary = !isTextCandidate(diff.From) || !isTextCandidate(diff.To)
+	if diff.From.ETag == diff.To.ETag && diff.From.Size == diff.To.Size {
+		return diff, nil
+	}
+
+	from, err := s.readDiffVersion(bucketName, objectKey, fromVersion, !diff.Binary, opts)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.readDiffVersion(bucketName, objectKey, toVersion, !diff.Binary, opts)
+	if err != nil {
+		return nil, err
+	}
+	diff.FromSHA256, diff.ToSHA256 = from.sha256, to.sha256
+	if diff.FromSHA256 != diff.ToSHA256 {
+		diff.Changes = append(diff.Changes, FieldChange{"SHA256", diff.FromSHA256, diff.ToSHA256})
+	}
+	diff.Binary = diff.Binary || !from.text || !to.text
+	if !diff.Binary {
+		diff.Unified = UnifiedDiff(objectKey+"@"+fromVersion, objectKey+"@"+toVersion, from.content, to.content)
+	}
+	return diff, nil
+}
+
+type diffContent struct {
+	sha256  string
+	content string
+	text    bool
+}
+
+// readDiffVersion hashes one version as it streams. With keepText set, up
+// to MaxTextDiffSize bytes are buffered; a larger or non-text body is
+// reported as not text and its content dropped.
+func (s *S3Base) readDiffVersion(bucketName, objectKey, versionId string, keepText bool, opts []GetOption) (*diffContent, error) {
+	input := &s3.GetObjectInput{
+		Bucket:    aws.String(bucketName),
+		Key:       aws.String(objectKey),
+		VersionId: aws.String(versionId),
+	}
+	newGetOptions(opts).applyGet(input)
+	output, err := s.S3Client.GetObject(context.TODO(), input)
+	if err != nil {
+		log.Printf("Couldn't get object %v:%v@%v. Here's why: %v\n", bucketName, objectKey, versionId, err)
+		return nil, err
+	}
+	body, err := decompressBody(output.ContentEncoding, output.Body)
+	if err != nil {
+		output.Body.Close()
+		return nil, err
+	}
+	defer body.Close()
+
+	hash := sha256.New()
+	var buf bytes.Buffer
+	reader := io.TeeReader(body, hash)
+	if keepText {
+		_, err = io.CopyN(&buf, reader, MaxTextDiffSize+1)
+		if err == io.EOF {
+			err = nil
+		}
+	}
+	if err == nil {
+		_, err = io.Copy(io.Discard, reader)
+	}
+	if err != nil {
+		log.Printf("Couldn't read object %v:%v@%v. Here's why: %v\n", bucketName, objectKey, versionId, err)
+		return nil, err
+	}
+	result := &diffContent{sha256: hex.EncodeToString(hash.Sum(nil))}
+	if keepText && isDiffableText(buf.Bytes()) {
+		result.content, result.text = buf.String(), true
+	}
+	return result, nil
+}
+
+// isTextCandidate rules out objects that can't get a text diff from their
+// metadata alone, so their bodies are only hashed.
+func isTextCandidate(info *ObjectInfo) bool {
+	if info.Size > MaxTextDiffSize && info.ContentEncoding == "" {
+		return false
+	}
+	contentType := strings.ToLower(info.ContentType)
+	for _, prefix := range []string{"image/", "audio/", "video/", "font/", "application/octet-stream", "application/zip", "application/gzip", "application/pdf"} {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDiffableText(content []byte) bool {
+	return len(content) <= MaxTextDiffSize && utf8.Valid(content) && bytes.IndexByte(content, 0) < 0
+}
+
+func compareObjectInfo(from, to *ObjectInfo) []FieldChange {
+	var changes []FieldChange
+	add := func(field, a, b string) {
+		if a != b {
+			changes = append(changes, FieldChange{field, a, b})
+		}
+	}
+	add("Size", fmt.Sprint(from.Size), fmt.Sprint(to.Size))
+	add("ETag", from.ETag, to.ETag)
+	add("ContentType", from.ContentType, to.ContentType)
+	add("CacheControl", from.CacheControl, to.CacheControl)
+	add("ContentDisposition", from.ContentDisposition, to.ContentDisposition)
+	add("ContentEncoding", from.ContentEncoding, to.ContentEncoding)
+	add("ContentLanguage", from.ContentLanguage, to.ContentLanguage)
+	add("StorageClass", string(from.StorageClass), string(to.StorageClass))
+	add("ServerSideEncryption", string(from.ServerSideEncryption), string(to.ServerSideEncryption))
+
+	keys := map[string]bool{}
+	for k := range from.Metadata {
+		keys[k] = true
+	}
+	for k := range to.Metadata {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	for _, k := range sorted {
+		add("Metadata."+k, from.Metadata[k], to.Metadata[k])
+	}
+	return changes
+}
+
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// UnifiedDiff returns the differences between two texts in unified diff
+// format with three lines of context, or "" if they are equal.
+func UnifiedDiff(fromName, toName, from, to string) string {
+	ops := diffLines(splitLines(from), splitLines(to))
+	var changed []int
+	for i, op := range ops {
+		if op.kind != ' ' {
+			changed = append(changed, i)
+		}
+	}
+	if len(changed) == 0 {
+		return ""
+	}
+
+	// fromLine[i] and toLine[i] are the line offsets at which op i starts.
+	fromLine, toLine := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, op := range ops {
+		fromLine[i+1], toLine[i+1] = fromLine[i], toLine[i]
+		if op.kind != '+' {
+			fromLine[i+1]++
+		}
+		if op.kind != '-' {
+			toLine[i+1]++
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", fromName, toName)
+	for k := 0; k < len(changed); {
+		start := changed[k] - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+		end := changed[k]
+		for k++; k < len(changed) && changed[k]-end-1 <= 2*diffContextLines; k++ {
+			end = changed[k]
+		}
+		stop := end + diffContextLines + 1
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n",
+			hunkRange(fromLine[start], fromLine[stop]-fromLine[start]),
+			hunkRange(toLine[start], toLine[stop]-toLine[start]))
+		for _, op := range ops[start:stop] {
+			buf.WriteByte(op.kind)
+			buf.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return buf.String()
+}
+
+func hunkRange(start, length int) string {
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+// splitLines keeps the newline on each line, so a last line without one
+// differs from the same line with one, as in diff(1).
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = append(ops, lcsDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// lcsDiff builds the edit script from a longest common subsequence table.
+// Inputs too large for the table are reported as a full replacement.
+func lcsDiff(a, b []string) []diffOp {
+	var ops []diffOp
+	n, m := len(a), len(b)
+	if n*m > maxLcsCells {
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+		return ops
+	}
+
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
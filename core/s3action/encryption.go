@@ -0,0 +1,316 @@
+package s3action
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type EncryptionMode string
+
+const (
+	EncryptionSSES3   EncryptionMode = "SSE-S3"
+	EncryptionSSEKMS  EncryptionMode = "SSE-KMS"
+	EncryptionDSSEKMS EncryptionMode = "DSSE-KMS"
+	EncryptionSSEC    EncryptionMode = "SSE-C"
+)
+
+// serverSideEncryptionDSSEKMS is dual-layer SSE-KMS, which this SDK version
+// has no constant for.
+const serverSideEncryptionDSSEKMS types.ServerSideEncryption = "aws:kms:dsse"
+
+// Encryption describes server-side encryption for a request. SSE-C keys
+// must be 32 bytes and have to be supplied again on every read.
+type Encryption struct {
+	Mode             EncryptionMode
+	KMSKeyId         string
+	BucketKeyEnabled bool
+	CustomerKey      []byte
+}
+
+func SSES3() *Encryption {
+	return &Encryption{Mode: EncryptionSSES3}
+}
+
+func SSEKMS(kmsKeyId string) *Encryption {
+	return &Encryption{Mode: EncryptionSSEKMS, KMSKeyId: kmsKeyId}
+}
+
+func DSSEKMS(kmsKeyId string) *Encryption {
+	return &Encryption{Mode: EncryptionDSSEKMS, KMSKeyId: kmsKeyId}
+}
+
+func SSEC(customerKey []byte) *Encryption {
+	return &Encryption{Mode: EncryptionSSEC, CustomerKey: customerKey}
+}
+
+func (e *Encryption) Validate() error {
+	if e == nil {
+		return nil
+	}
+	switch e.Mode {
+	case EncryptionSSES3, EncryptionSSEKMS, EncryptionDSSEKMS:
+		return nil
+	case EncryptionSSEC:
+		if len(e.CustomerKey) != 32 {
+			return fmt.Errorf("SSE-C key must be 32 bytes, got %d", len(e.CustomerKey))
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown encryption mode %q", e.Mode)
+	}
+}
+
+type sseCustomerHeaders struct {
+	algorithm *string
+	key       *string
+	keyMD5    *string
+}
+
+func customerKeyHeaders(key []byte) sseCustomerHeaders {
+	if len(key) == 0 {
+		return sseCustomerHeaders{}
+	}
+	sum := md5.Sum(key)
+	return sseCustomerHeaders{
+		algorithm: aws.String(string(types.ServerSideEncryptionAes256)),
+		key:       aws.String(base64.StdEncoding.EncodeToString(key)),
+		keyMD5:    aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+	}
+}
+
+func (e *Encryption) serverSide() (types.ServerSideEncryption, *string) {
+	switch e.Mode {
+	case EncryptionSSES3:
+		return types.ServerSideEncryptionAes256, nil
+	case EncryptionSSEKMS:
+		return types.ServerSideEncryptionAwsKms, optionalString(e.KMSKeyId)
+	case EncryptionDSSEKMS:
+		return serverSideEncryptionDSSEKMS, optionalString(e.KMSKeyId)
+	}
+	return "", nil
+}
+
+func (e *Encryption) customerKey() []byte {
+	if e == nil || e.Mode != EncryptionSSEC {
+		return nil
+	}
+	return e.CustomerKey
+}
+
+func (e *Encryption) applyPut(input *s3.PutObjectInput) {
+	if e == nil {
+		return
+	}
+	input.ServerSideEncryption, input.SSEKMSKeyId = e.serverSide()
+	input.BucketKeyEnabled = e.BucketKeyEnabled
+	h := customerKeyHeaders(e.customerKey())
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = h.algorithm, h.key, h.keyMD5
+}
+
+func (e *Encryption) applyCreateMultipart(input *s3.CreateMultipartUploadInput) {
+	if e == nil {
+		return
+	}
+	input.ServerSideEncryption, input.SSEKMSKeyId = e.serverSide()
+	input.BucketKeyEnabled = e.BucketKeyEnabled
+	h := customerKeyHeaders(e.customerKey())
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = h.algorithm, h.key, h.keyMD5
+}
+
+func (e *Encryption) applyUploadPart(input *s3.UploadPartInput) {
+	h := customerKeyHeaders(e.customerKey())
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = h.algorithm, h.key, h.keyMD5
+}
+
+func (e *Encryption) applyCopy(input *s3.CopyObjectInput) {
+	if e == nil {
+		return
+	}
+	input.ServerSideEncryption, input.SSEKMSKeyId = e.serverSide()
+	input.BucketKeyEnabled = e.BucketKeyEnabled
+	h := customerKeyHeaders(e.customerKey())
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = h.algorithm, h.key, h.keyMD5
+}
+
+func WithEncryption(encryption *Encryption) PutOption {
+	return func(o *PutOptions) {
+		o.Encryption = encryption
+	}
+}
+
+// GetOptions holds settings for reading an object. Only SSE-C objects need
+// the customer key; SSE-S3 and SSE-KMS are decrypted by S3.
+type GetOptions struct {
+	SSECustomerKey []byte
+}
+
+type GetOption func(*GetOptions)
+
+func WithSSECustomerKey(key []byte) GetOption {
+	return func(o *GetOptions) {
+		o.SSECustomerKey = key
+	}
+}
+
+func newGetOptions(opts []GetOption) *GetOptions {
+	getOptions := &GetOptions{}
+	for _, opt := range opts {
+		opt(getOptions)
+	}
+	return getOptions
+}
+
+func (o *GetOptions) applyGet(input *s3.GetObjectInput) {
+	h := customerKeyHeaders(o.SSECustomerKey)
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = h.algorithm, h.key, h.keyMD5
+}
+
+func (o *GetOptions) applyHead(input *s3.HeadObjectInput) {
+	h := customerKeyHeaders(o.SSECustomerKey)
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = h.algorithm, h.key, h.keyMD5
+}
+
+type CopyOptions struct {
+	Encryption           *Encryption
+	SourceSSECustomerKey []byte
+	SourceVersionId      string
+}
+
+type CopyOption func(*CopyOptions)
+
+func WithCopyEncryption(encryption *Encryption) CopyOption {
+	return func(o *CopyOptions) {
+		o.Encryption = encryption
+	}
+}
+
+func WithCopySourceSSECustomerKey(key []byte) CopyOption {
+	return func(o *CopyOptions) {
+		o.SourceSSECustomerKey = key
+	}
+}
+
+// WithCopySourceVersion copies a specific version of the source object
+// instead of the current one.
+func WithCopySourceVersion(versionId string) CopyOption {
+	return func(o *CopyOptions) {
+		o.SourceVersionId = versionId
+	}
+}
+
+func (o *CopyOptions) apply(input *s3.CopyObjectInput) {
+	o.Encryption.applyCopy(input)
+	h := customerKeyHeaders(o.SourceSSECustomerKey)
+	input.CopySourceSSECustomerAlgorithm, input.CopySourceSSECustomerKey, input.CopySourceSSECustomerKeyMD5 = h.algorithm, h.key, h.keyMD5
+}
+
+// keepSourceEncryption fills in the encryption of a copy that would otherwise
+// fall back to the bucket default. SSE-C sources are re-encrypted with the
+// source key, and the KMS key of SSE-KMS and DSSE-KMS sources is read from
+// the source object.
+func (s *S3Base) keepSourceEncryption(ctx context.Context, bucketName, objectKey string, copyOptions *CopyOptions) error {
+	if copyOptions.Encryption != nil {
+		return nil
+	}
+	if len(copyOptions.SourceSSECustomerKey) > 0 {
+		copyOptions.Encryption = SSEC(copyOptions.SourceSSECustomerKey)
+		return nil
+	}
+	input := &s3.HeadObjectInput{
+		Bucket:    aws.String(bucketName),
+		Key:       aws.String(objectKey),
+		VersionId: optionalString(copyOptions.SourceVersionId),
+	}
+	info, err := s.statObject(ctx, input, nil)
+	if err != nil {
+		return err
+	}
+	switch info.ServerSideEncryption {
+	case types.ServerSideEncryptionAwsKms:
+		copyOptions.Encryption = SSEKMS(info.SSEKMSKeyId)
+	case serverSideEncryptionDSSEKMS:
+		copyOptions.Encryption = DSSEKMS(info.SSEKMSKeyId)
+	default:
+		return nil
+	}
+	copyOptions.Encryption.BucketKeyEnabled = info.BucketKeyEnabled
+	return nil
+}
+
+func (s *S3Base) GetBucketEncryption(bucketName string) (*Encryption, error) {
+	output, err := s.S3Client.GetBucketEncryption(context.TODO(), &s3.GetBucketEncryptionInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		log.Printf("Couldn't get default encryption of bucket %v. Here's why: %v\n", bucketName, err)
+		return nil, err
+	}
+	if output.ServerSideEncryptionConfiguration == nil {
+		return nil, nil
+	}
+	for _, rule := range output.ServerSideEncryptionConfiguration.Rules {
+		byDefault := rule.ApplyServerSideEncryptionByDefault
+		if byDefault == nil {
+			continue
+		}
+		encryption := &Encryption{BucketKeyEnabled: rule.BucketKeyEnabled}
+		switch byDefault.SSEAlgorithm {
+		case types.ServerSideEncryptionAes256:
+			encryption.Mode = EncryptionSSES3
+		case types.ServerSideEncryptionAwsKms:
+			encryption.Mode = EncryptionSSEKMS
+			encryption.KMSKeyId = aws.ToString(byDefault.KMSMasterKeyID)
+		case serverSideEncryptionDSSEKMS:
+			encryption.Mode = EncryptionDSSEKMS
+			encryption.KMSKeyId = aws.ToString(byDefault.KMSMasterKeyID)
+		default:
+			return nil, fmt.Errorf("bucket %v uses unsupported default encryption %q", bucketName, byDefault.SSEAlgorithm)
+		}
+		return encryption, nil
+	}
+	return nil, nil
+}
+
+func (s *S3Base) PutBucketEncryption(bucketName string, encryption *Encryption) error {
+	if encryption == nil || encryption.Mode == EncryptionSSEC {
+		return errors.New("bucket default encryption must be SSE-S3, SSE-KMS or DSSE-KMS")
+	}
+	if err := encryption.Validate(); err != nil {
+		return err
+	}
+	algorithm, kmsKeyId := encryption.serverSide()
+	_, err := s.S3Client.PutBucketEncryption(context.TODO(), &s3.PutBucketEncryptionInput{
+		Bucket: aws.String(bucketName),
+		ServerSideEncryptionConfiguration: &types.ServerSideEncryptionConfiguration{
+			Rules: []types.ServerSideEncryptionRule{{
+				ApplyServerSideEncryptionByDefault: &types.ServerSideEncryptionByDefault{
+					SSEAlgorithm:   algorithm,
+					KMSMasterKeyID: kmsKeyId,
+				},
+				BucketKeyEnabled: encryption.BucketKeyEnabled,
+			}},
+		},
+	})
+	if err != nil {
+		log.Printf("Couldn't put default encryption on bucket %v. Here's why: %v\n", bucketName, err)
+	}
+	return err
+}
+
+func (s *S3Base) DeleteBucketEncryption(bucketName string) error {
+	_, err := s.S3Client.DeleteBucketEncryption(context.TODO(), &s3.DeleteBucketEncryptionInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		log.Printf("Couldn't delete default encryption of bucket %v. Here's why: %v\n", bucketName, err)
+	}
+	return err
+}
@@ -0,0 +1,399 @@
+package s3action
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	envelopeAlgorithm        = "AES256-GCM-CHUNKED"
+	envelopeMetaAlgorithm    = "cse-algorithm"
+	envelopeMetaKeyId        = "cse-key-id"
+	envelopeMetaWrappedKey   = "cse-wrapped-key"
+	envelopeMetaNonce        = "cse-nonce"
+	envelopeMetaChunkSize    = "cse-chunk-size"
+	DefaultEnvelopeChunkSize = 64 * 1024
+	gcmTagSize               = 16
+)
+
+var ErrNotEnvelopeEncrypted = errors.New("object is not envelope encrypted")
+
+// EncryptionClient encrypts object bodies before they leave the process.
+// Each object gets a random data key, wrapped by Keys and stored with the
+// nonce in object metadata. Bodies are split into ChunkSize pieces sealed
+// separately, so downloads stream and ranged reads fetch only the chunks
+// they need.
+type EncryptionClient struct {
+	S3        *S3Base
+	Keys      KeyProvider
+	ChunkSize int
+}
+
+func NewEncryptionClient(base *S3Base, keys KeyProvider) *EncryptionClient {
+	return &EncryptionClient{S3: base, Keys: keys, ChunkSize: DefaultEnvelopeChunkSize}
+}
+
+type envelope struct {
+	aead      cipher.AEAD
+	nonce     []byte
+	chunkSize int
+}
+
+func (e *envelope) chunkNonce(index uint64) []byte {
+	nonce := make([]byte, len(e.nonce))
+	copy(nonce, e.nonce)
+	tail := nonce[len(nonce)-8:]
+	binary.BigEndian.PutUint64(tail, binary.BigEndian.Uint64(tail)^index)
+	return nonce
+}
+
+func chunkAAD(index uint64, final bool) []byte {
+	aad := make([]byte, 9)
+	binary.BigEndian.PutUint64(aad, index)
+	if final {
+		aad[8] = 1
+	}
+	return aad
+}
+
+func (e *envelope) cipherChunkSize() int64 {
+	return int64(e.chunkSize + gcmTagSize)
+}
+
+// chunkCount returns how many chunks a ciphertext of the given length holds.
+func (e *envelope) chunkCount(cipherLength int64) int64 {
+	return (cipherLength + e.cipherChunkSize() - 1) / e.cipherChunkSize()
+}
+
+func (e *envelope) plainLength(cipherLength int64) int64 {
+	return cipherLength - gcmTagSize*e.chunkCount(cipherLength)
+}
+
+func (c *EncryptionClient) newEnvelope() (*envelope, map[string]string, error) {
+	chunkSize := c.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultEnvelopeChunkSize
+	}
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, err
+	}
+	keyId, wrapped, err := c.Keys.WrapKey(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	metadata := map[string]string{
+		envelopeMetaAlgorithm:  envelopeAlgorithm,
+		envelopeMetaKeyId:      keyId,
+		envelopeMetaWrappedKey: base64.StdEncoding.EncodeToString(wrapped),
+		envelopeMetaNonce:      base64.StdEncoding.EncodeToString(nonce),
+		envelopeMetaChunkSize:  strconv.Itoa(chunkSize),
+	}
+	return &envelope{aead: aead, nonce: nonce, chunkSize: chunkSize}, metadata, nil
+}
+
+func (c *EncryptionClient) openEnvelope(metadata map[string]string) (*envelope, error) {
+	if metadata[envelopeMetaAlgorithm] != envelopeAlgorithm {
+		return nil, ErrNotEnvelopeEncrypted
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(metadata[envelopeMetaWrappedKey])
+	if err != nil {
+		return nil, fmt.Errorf("decode wrapped key: %w", err)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(metadata[envelopeMetaNonce])
+	if err != nil {
+		return nil, fmt.Errorf("decode nonce: %w", err)
+	}
+	chunkSize, err := strconv.Atoi(metadata[envelopeMetaChunkSize])
+	if err != nil || chunkSize <= 0 {
+		return nil, fmt.Errorf("invalid chunk size %q", metadata[envelopeMetaChunkSize])
+	}
+	dataKey, err := c.Keys.UnwrapKey(metadata[envelopeMetaKeyId], wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce length")
+	}
+	return &envelope{aead: aead, nonce: nonce, chunkSize: chunkSize}, nil
+}
+
+type encryptReader struct {
+	env   *envelope
+	src   io.Reader
+	index uint64
+	cur   []byte
+	out   []byte
+	done  bool
+}
+
+func (r *encryptReader) readChunk() ([]byte, error) {
+	buf := make([]byte, r.env.chunkSize)
+	n, err := io.ReadFull(r.src, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return buf[:n], err
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if r.cur == nil {
+			cur, err := r.readChunk()
+			if err != nil {
+				return 0, err
+			}
+			r.cur = cur
+		}
+		next, err := r.readChunk()
+		if err != nil {
+			return 0, err
+		}
+		final := len(next) == 0
+		r.out = r.env.aead.Seal(nil, r.env.chunkNonce(r.index), r.cur, chunkAAD(r.index, final))
+		r.index++
+		r.cur = next
+		r.done = final
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+type decryptReader struct {
+	env       *envelope
+	src       io.ReadCloser
+	index     uint64
+	lastIndex uint64
+	out       []byte
+	done      bool
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		buf := make([]byte, r.env.cipherChunkSize())
+		n, err := io.ReadFull(r.src, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		final := r.index == r.lastIndex
+		r.out, err = r.env.aead.Open(nil, r.env.chunkNonce(r.index), buf[:n], chunkAAD(r.index, final))
+		if err != nil {
+			return 0, fmt.Errorf("decrypt chunk %d: %w", r.index, err)
+		}
+		r.index++
+		r.done = final
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *decryptReader) Close() error {
+	return r.src.Close()
+}
+
+// PutObject encrypts body on the client and uploads it. Compression is
+// rejected: ciphertext doesn't compress, and a Content-Encoding on the
+// encrypted object would be undone before decryption on download.
+func (c *EncryptionClient) PutObject(bucketName, objectKey string, body io.Reader, opts ...PutOption) error {
+	if newPutOptions(opts).Compression != nil {
+		err := errors.New("compression is not supported for client-side encrypted objects")
+		log.Printf("Couldn't upload encrypted object to %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+		return err
+	}
+	env, metadata, err := c.newEnvelope()
+	if err != nil {
+		log.Printf("Couldn't create data key for %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+		return err
+	}
+	putOptions := newPutOptions(append(opts, WithMetadata(metadata)))
+	if err = putOptions.validate(); err != nil {
+		log.Printf("Couldn't upload encrypted object to %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+		return err
+	}
+	if putOptions.ContentType == "" {
+		putOptions.ContentType = DetectContentType(objectKey, nil)
+	}
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectKey),
+		Body:   &encryptReader{env: env, src: body},
+	}
+	putOptions.apply(input)
+
+	uploader := manager.NewUploader(c.S3.S3Client)
+	_, err = uploader.Upload(context.TODO(), input)
+	if err != nil {
+		log.Printf("Couldn't upload encrypted object to %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+	}
+	return err
+}
+
+func (c *EncryptionClient) UploadFile(bucketName, objectKey, fileName string, opts ...PutOption) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		log.Printf("Couldn't open file %v to upload. Here's why: %v\n", fileName, err)
+		return err
+	}
+	defer file.Close()
+	return c.PutObject(bucketName, objectKey, file, opts...)
+}
+
+// GetObject returns a reader that decrypts the object as it streams.
+func (c *EncryptionClient) GetObject(bucketName, objectKey string, opts ...GetOption) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectKey),
+	}
+	newGetOptions(opts).applyGet(input)
+	output, err := c.S3.S3Client.GetObject(context.TODO(), input)
+	if err != nil {
+		log.Printf("Couldn't get object %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+		return nil, err
+	}
+	env, err := c.openEnvelope(output.Metadata)
+	if err != nil {
+		output.Body.Close()
+		return nil, err
+	}
+	lastIndex := env.chunkCount(output.ContentLength) - 1
+	if lastIndex < 0 {
+		output.Body.Close()
+		return nil, errors.New("encrypted object is empty")
+	}
+	return &decryptReader{env: env, src: output.Body, lastIndex: uint64(lastIndex)}, nil
+}
+
+func (c *EncryptionClient) GetObjectContent(bucketName, objectKey string, opts ...GetOption) (string, error) {
+	body, err := c.GetObject(bucketName, objectKey, opts...)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	buf := new(bytes.Buffer)
+	_, err = buf.ReadFrom(body)
+	return buf.String(), err
+}
+
+func (c *EncryptionClient) DownloadFile(bucketName, objectKey, fileName string, opts ...GetOption) error {
+	body, err := c.GetObject(bucketName, objectKey, opts...)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	file, err := os.Create(fileName)
+	if err != nil {
+		log.Printf("Couldn't create file %v. Here's why: %v\n", fileName, err)
+		return err
+	}
+	if _, err = io.Copy(file, body); err != nil {
+		file.Close()
+		log.Printf("Couldn't decrypt %v:%v into %v. Here's why: %v\n", bucketName, objectKey, fileName, err)
+		return err
+	}
+	return file.Close()
+}
+
+// GetObjectRange reads length plaintext bytes starting at offset, fetching
+// only the encrypted chunks that cover the range.
+func (c *EncryptionClient) GetObjectRange(bucketName, objectKey string, offset, length int64, opts ...GetOption) ([]byte, error) {
+	if offset < 0 || length <= 0 {
+		return nil, fmt.Errorf("invalid range offset %d length %d", offset, length)
+	}
+	info, err := c.S3.StatObject(bucketName, objectKey, opts...)
+	if err != nil {
+		return nil, err
+	}
+	env, err := c.openEnvelope(info.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	plainLength := env.plainLength(info.Size)
+	if offset >= plainLength {
+		return nil, fmt.Errorf("offset %d is beyond object size %d", offset, plainLength)
+	}
+	if offset+length > plainLength {
+		length = plainLength - offset
+	}
+
+	firstChunk := offset / int64(env.chunkSize)
+	lastChunk := (offset + length - 1) / int64(env.chunkSize)
+	start := firstChunk * env.cipherChunkSize()
+	end := (lastChunk+1)*env.cipherChunkSize() - 1
+	if end >= info.Size {
+		end = info.Size - 1
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectKey),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+	}
+	// Read the same object the envelope came from, in case the key was
+	// overwritten since the HEAD request.
+	if info.VersionId != "" {
+		input.VersionId = aws.String(info.VersionId)
+	} else {
+		input.IfMatch = aws.String(`"` + info.ETag + `"`)
+	}
+	newGetOptions(opts).applyGet(input)
+	output, err := c.S3.S3Client.GetObject(context.TODO(), input)
+	if err != nil {
+		log.Printf("Couldn't get range of object %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+		return nil, err
+	}
+	reader := &decryptReader{
+		env:       env,
+		src:       output.Body,
+		index:     uint64(firstChunk),
+		lastIndex: uint64(env.chunkCount(info.Size) - 1),
+	}
+	defer reader.Close()
+
+	plain := make([]byte, (lastChunk-firstChunk+1)*int64(env.chunkSize))
+	n, err := io.ReadFull(reader, plain)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	skip := offset - firstChunk*int64(env.chunkSize)
+	if int64(n) < skip+length {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return plain[skip : skip+length], nil
+}
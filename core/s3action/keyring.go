@@ -0,0 +1,120 @@
+package s3action
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// KeyProvider wraps and unwraps per-object data keys. Implementations can
+// be backed by a KMS; LocalKeyring keeps master keys in a file for tests.
+type KeyProvider interface {
+	WrapKey(dataKey []byte) (keyId string, wrapped []byte, err error)
+	UnwrapKey(keyId string, wrapped []byte) ([]byte, error)
+}
+
+type LocalKeyring struct {
+	mu      sync.RWMutex
+	Current string            `json:"current"`
+	Keys    map[string][]byte `json:"keys"`
+}
+
+func NewLocalKeyring() *LocalKeyring {
+	return &LocalKeyring{Keys: map[string][]byte{}}
+}
+
+func LoadLocalKeyring(path string) (*LocalKeyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keyring := NewLocalKeyring()
+	if err := json.Unmarshal(data, keyring); err != nil {
+		return nil, fmt.Errorf("parse keyring %v: %w", path, err)
+	}
+	if _, ok := keyring.Keys[keyring.Current]; !ok {
+		return nil, fmt.Errorf("keyring %v has no current key %q", path, keyring.Current)
+	}
+	return keyring, nil
+}
+
+func (k *LocalKeyring) Save(path string) error {
+	k.mu.RLock()
+	data, err := json.MarshalIndent(k, "", "  ")
+	k.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// GenerateKey adds a random 256-bit master key and makes it current.
+func (k *LocalKeyring) GenerateKey(keyId string) error {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return err
+	}
+	return k.AddKey(keyId, key)
+}
+
+func (k *LocalKeyring) AddKey(keyId string, key []byte) error {
+	if len(key) != 32 {
+		return fmt.Errorf("master key %v must be 32 bytes, got %d", keyId, len(key))
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.Keys[keyId] = key
+	k.Current = keyId
+	return nil
+}
+
+func (k *LocalKeyring) WrapKey(dataKey []byte) (string, []byte, error) {
+	k.mu.RLock()
+	keyId := k.Current
+	master, ok := k.Keys[keyId]
+	k.mu.RUnlock()
+	if !ok {
+		return "", nil, errors.New("keyring has no current key")
+	}
+	aead, err := newGCM(master)
+	if err != nil {
+		return "", nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", nil, err
+	}
+	return keyId, aead.Seal(nonce, nonce, dataKey, []byte(keyId)), nil
+}
+
+func (k *LocalKeyring) UnwrapKey(keyId string, wrapped []byte) ([]byte, error) {
+	k.mu.RLock()
+	master, ok := k.Keys[keyId]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("keyring has no key %q", keyId)
+	}
+	aead, err := newGCM(master)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped key is too short")
+	}
+	nonce, sealed := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, []byte(keyId))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
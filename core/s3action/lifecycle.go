@@ -0,0 +1,373 @@
+package s3action
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const maxLifecycleRules = 1000
+
+type LifecycleTransition struct {
+	Days         int32
+	StorageClass types.TransitionStorageClass
+}
+
+// LifecycleRule is a flattened form of types.LifecycleRule. A rule applies
+// to objects under Prefix that carry every tag in Tags.
+type LifecycleRule struct {
+	ID                           string
+	Enabled                      bool
+	Prefix                       string
+	Tags                         map[string]string
+	ExpirationDays               int32
+	ExpiredObjectDeleteMarker    bool
+	NoncurrentExpirationDays     int32
+	NewerNoncurrentVersions      int32
+	Transitions                  []LifecycleTransition
+	NoncurrentTransitions        []LifecycleTransition
+	AbortIncompleteMultipartDays int32
+}
+
+func NewLifecycleRule(id string) *LifecycleRule {
+	return &LifecycleRule{ID: id, Enabled: true}
+}
+
+func (r *LifecycleRule) WithPrefix(prefix string) *LifecycleRule {
+	r.Prefix = prefix
+	return r
+}
+
+func (r *LifecycleRule) WithTag(key, value string) *LifecycleRule {
+	if r.Tags == nil {
+		r.Tags = map[string]string{}
+	}
+	r.Tags[key] = value
+	return r
+}
+
+func (r *LifecycleRule) ExpireAfter(days int32) *LifecycleRule {
+	r.ExpirationDays = days
+	return r
+}
+
+func (r *LifecycleRule) RemoveExpiredDeleteMarkers() *LifecycleRule {
+	r.ExpiredObjectDeleteMarker = true
+	return r
+}
+
+// ExpireNoncurrentAfter removes noncurrent versions days after they stop
+// being current, keeping the newest keepNewer of them.
+func (r *LifecycleRule) ExpireNoncurrentAfter(days, keepNewer int32) *LifecycleRule {
+	r.NoncurrentExpirationDays = days
+	r.NewerNoncurrentVersions = keepNewer
+	return r
+}
+
+func (r *LifecycleRule) TransitionAfter(days int32, storageClass types.TransitionStorageClass) *LifecycleRule {
+	r.Transitions = append(r.Transitions, LifecycleTransition{Days: days, StorageClass: storageClass})
+	return r
+}
+
+func (r *LifecycleRule) TransitionNoncurrentAfter(days int32, storageClass types.TransitionStorageClass) *LifecycleRule {
+	r.NoncurrentTransitions = append(r.NoncurrentTransitions, LifecycleTransition{Days: days, StorageClass: storageClass})
+	return r
+}
+
+func (r *LifecycleRule) AbortIncompleteMultipartAfter(days int32) *LifecycleRule {
+	r.AbortIncompleteMultipartDays = days
+	return r
+}
+
+func (r *LifecycleRule) Disable() *LifecycleRule {
+	r.Enabled = false
+	return r
+}
+
+func (r *LifecycleRule) toSDK() types.LifecycleRule {
+	rule := types.LifecycleRule{
+		ID:     aws.String(r.ID),
+		Status: types.ExpirationStatusDisabled,
+	}
+	if r.Enabled {
+		rule.Status = types.ExpirationStatusEnabled
+	}
+	switch {
+	case len(r.Tags) == 0:
+		rule.Filter = &types.LifecycleRuleFilterMemberPrefix{Value: r.Prefix}
+	case len(r.Tags) == 1 && r.Prefix == "":
+		tag := toTagSet(r.Tags)[0]
+		rule.Filter = &types.LifecycleRuleFilterMemberTag{Value: tag}
+	default:
+		rule.Filter = &types.LifecycleRuleFilterMemberAnd{Value: types.LifecycleRuleAndOperator{
+			Prefix: optionalString(r.Prefix),
+			Tags:   toTagSet(r.Tags),
+		}}
+	}
+	if r.ExpirationDays > 0 || r.ExpiredObjectDeleteMarker {
+		rule.Expiration = &types.LifecycleExpiration{
+			Days:                      r.ExpirationDays,
+			ExpiredObjectDeleteMarker: r.ExpiredObjectDeleteMarker,
+		}
+	}
+	if r.NoncurrentExpirationDays > 0 {
+		rule.NoncurrentVersionExpiration = &types.NoncurrentVersionExpiration{
+			NoncurrentDays:          r.NoncurrentExpirationDays,
+			NewerNoncurrentVersions: r.NewerNoncurrentVersions,
+		}
+	}
+	for _, t := range r.Transitions {
+		rule.Transitions = append(rule.Transitions, types.Transition{Days: t.Days, StorageClass: t.StorageClass})
+	}
+	for _, t := range r.NoncurrentTransitions {
+		rule.NoncurrentVersionTransitions = append(rule.NoncurrentVersionTransitions,
+			types.NoncurrentVersionTransition{NoncurrentDays: t.Days, StorageClass: t.StorageClass})
+	}
+	if r.AbortIncompleteMultipartDays > 0 {
+		rule.AbortIncompleteMultipartUpload = &types.AbortIncompleteMultipartUpload{
+			DaysAfterInitiation: r.AbortIncompleteMultipartDays,
+		}
+	}
+	return rule
+}
+
+func lifecycleRuleFromSDK(rule types.LifecycleRule) LifecycleRule {
+	r := LifecycleRule{
+		ID:      aws.ToString(rule.ID),
+		Enabled: rule.Status == types.ExpirationStatusEnabled,
+		Prefix:  aws.ToString(rule.Prefix),
+	}
+	switch filter := rule.Filter.(type) {
+	case *types.LifecycleRuleFilterMemberPrefix:
+		r.Prefix = filter.Value
+	case *types.LifecycleRuleFilterMemberTag:
+		r.Tags = fromTagSet([]types.Tag{filter.Value})
+	case *types.LifecycleRuleFilterMemberAnd:
+		r.Prefix = aws.ToString(filter.Value.Prefix)
+		if len(filter.Value.Tags) > 0 {
+			r.Tags = fromTagSet(filter.Value.Tags)
+		}
+	}
+	if rule.Expiration != nil {
+		r.ExpirationDays = rule.Expiration.Days
+		r.ExpiredObjectDeleteMarker = rule.Expiration.ExpiredObjectDeleteMarker
+	}
+	if rule.NoncurrentVersionExpiration != nil {
+		r.NoncurrentExpirationDays = rule.NoncurrentVersionExpiration.NoncurrentDays
+		r.NewerNoncurrentVersions = rule.NoncurrentVersionExpiration.NewerNoncurrentVersions
+	}
+	for _, t := range rule.Transitions {
+		r.Transitions = append(r.Transitions, LifecycleTransition{Days: t.Days, StorageClass: t.StorageClass})
+	}
+	for _, t := range rule.NoncurrentVersionTransitions {
+		r.NoncurrentTransitions = append(r.NoncurrentTransitions,
+			LifecycleTransition{Days: t.NoncurrentDays, StorageClass: t.StorageClass})
+	}
+	if rule.AbortIncompleteMultipartUpload != nil {
+		r.AbortIncompleteMultipartDays = rule.AbortIncompleteMultipartUpload.DaysAfterInitiation
+	}
+	return r
+}
+
+type IssueLevel string
+
+const (
+	IssueError   IssueLevel = "ERROR"
+	IssueWarning IssueLevel = "WARNING"
+)
+
+type LifecycleIssue struct {
+	Level   IssueLevel
+	RuleID  string
+	Message string
+}
+
+func (i LifecycleIssue) String() string {
+	return fmt.Sprintf("%s rule %q: %s", i.Level, i.RuleID, i.Message)
+}
+
+var minTransitionDays = map[types.TransitionStorageClass]int32{
+	types.TransitionStorageClassStandardIa: 30,
+	types.TransitionStorageClassOnezoneIa:  30,
+}
+
+// ValidateLifecycleRules reports rules S3 would reject (errors) and rules
+// that overlap in ways that are probably unintended (warnings).
+func ValidateLifecycleRules(rules []LifecycleRule) []LifecycleIssue {
+	var issues []LifecycleIssue
+	add := func(level IssueLevel, id, format string, a ...interface{}) {
+		issues = append(issues, LifecycleIssue{Level: level, RuleID: id, Message: fmt.Sprintf(format, a...)})
+	}
+
+	if len(rules) > maxLifecycleRules {
+		add(IssueError, "", "%d rules exceed the limit of %d", len(rules), maxLifecycleRules)
+	}
+	seen := map[string]bool{}
+	for _, r := range rules {
+		switch {
+		case r.ID == "":
+			add(IssueError, r.ID, "rule has no ID")
+		case len(r.ID) > 255:
+			add(IssueError, r.ID, "ID is longer than 255 characters")
+		case seen[r.ID]:
+			add(IssueError, r.ID, "duplicate rule ID")
+		}
+		seen[r.ID] = true
+
+		if r.ExpirationDays == 0 && !r.ExpiredObjectDeleteMarker && r.NoncurrentExpirationDays == 0 &&
+			len(r.Transitions) == 0 && len(r.NoncurrentTransitions) == 0 && r.AbortIncompleteMultipartDays == 0 {
+			add(IssueError, r.ID, "rule has no action")
+		}
+		if r.ExpirationDays < 0 || r.NoncurrentExpirationDays < 0 || r.AbortIncompleteMultipartDays < 0 {
+			add(IssueError, r.ID, "days must not be negative")
+		}
+		if r.ExpiredObjectDeleteMarker && r.ExpirationDays > 0 {
+			add(IssueError, r.ID, "expired object delete marker cannot be combined with expiration days")
+		}
+		if len(r.Tags) > 0 && (r.ExpiredObjectDeleteMarker || r.AbortIncompleteMultipartDays > 0) {
+			add(IssueError, r.ID, "delete marker and abort-incomplete-multipart actions cannot use tag filters")
+		}
+		if r.NewerNoncurrentVersions > 100 {
+			add(IssueError, r.ID, "newer noncurrent versions must be at most 100")
+		}
+		issues = append(issues, validateTransitions(r.ID, "transition", r.Transitions, r.ExpirationDays)...)
+		issues = append(issues, validateTransitions(r.ID, "noncurrent transition", r.NoncurrentTransitions, r.NoncurrentExpirationDays)...)
+	}
+
+	for i := range rules {
+		for j := i + 1; j < len(rules); j++ {
+			a, b := rules[i], rules[j]
+			if !a.Enabled || !b.Enabled || !lifecycleFiltersOverlap(a, b) {
+				continue
+			}
+			if a.ExpirationDays > 0 && b.ExpirationDays > 0 && a.ExpirationDays != b.ExpirationDays {
+				add(IssueWarning, a.ID, "overlaps rule %q with different expiration (%d vs %d days); the shorter one wins",
+					b.ID, a.ExpirationDays, b.ExpirationDays)
+			}
+			if a.NoncurrentExpirationDays > 0 && b.NoncurrentExpirationDays > 0 &&
+				a.NoncurrentExpirationDays != b.NoncurrentExpirationDays {
+				add(IssueWarning, a.ID, "overlaps rule %q with different noncurrent expiration (%d vs %d days)",
+					b.ID, a.NoncurrentExpirationDays, b.NoncurrentExpirationDays)
+			}
+			if len(a.Transitions) > 0 && len(b.Transitions) > 0 {
+				add(IssueWarning, a.ID, "overlaps rule %q and both transition objects", b.ID)
+			}
+			if (a.ExpirationDays > 0 && transitionsAfter(b.Transitions, a.ExpirationDays)) ||
+				(b.ExpirationDays > 0 && transitionsAfter(a.Transitions, b.ExpirationDays)) {
+				add(IssueWarning, a.ID, "overlaps rule %q and one rule expires objects before the other transitions them", b.ID)
+			}
+		}
+	}
+	return issues
+}
+
+func validateTransitions(id, kind string, transitions []LifecycleTransition, expirationDays int32) []LifecycleIssue {
+	var issues []LifecycleIssue
+	sorted := append([]LifecycleTransition(nil), transitions...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Days < sorted[j].Days })
+	classes := map[types.TransitionStorageClass]bool{}
+	for i, t := range sorted {
+		if classes[t.StorageClass] {
+			issues = append(issues, LifecycleIssue{IssueError, id, fmt.Sprintf("%s to %v is listed twice", kind, t.StorageClass)})
+		}
+		classes[t.StorageClass] = true
+		if min, ok := minTransitionDays[t.StorageClass]; ok && t.Days < min {
+			issues = append(issues, LifecycleIssue{IssueError, id,
+				fmt.Sprintf("%s to %v needs at least %d days, got %d", kind, t.StorageClass, min, t.Days)})
+		}
+		if i > 0 && sorted[i-1].Days == t.Days {
+			issues = append(issues, LifecycleIssue{IssueError, id,
+				fmt.Sprintf("%ss to %v and %v happen on the same day", kind, sorted[i-1].StorageClass, t.StorageClass)})
+		}
+		if expirationDays > 0 && t.Days >= expirationDays {
+			issues = append(issues, LifecycleIssue{IssueError, id,
+				fmt.Sprintf("%s to %v after %d days is not before expiration at %d days", kind, t.StorageClass, t.Days, expirationDays)})
+		}
+	}
+	return issues
+}
+
+func transitionsAfter(transitions []LifecycleTransition, days int32) bool {
+	for _, t := range transitions {
+		if t.Days >= days {
+			return true
+		}
+	}
+	return false
+}
+
+// lifecycleFiltersOverlap reports whether some object could match both
+// rules: one prefix contains the other and no tag key requires two values.
+func lifecycleFiltersOverlap(a, b LifecycleRule) bool {
+	if !strings.HasPrefix(a.Prefix, b.Prefix) && !strings.HasPrefix(b.Prefix, a.Prefix) {
+		return false
+	}
+	for key, value := range a.Tags {
+		if other, ok := b.Tags[key]; ok && other != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *S3Base) GetBucketLifecycle(bucketName string) ([]LifecycleRule, error) {
+	output, err := s.S3Client.GetBucketLifecycleConfiguration(context.TODO(), &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		log.Printf("Couldn't get lifecycle rules of bucket %v. Here's why: %v\n", bucketName, err)
+		return nil, err
+	}
+	rules := make([]LifecycleRule, len(output.Rules))
+	for i, rule := range output.Rules {
+		rules[i] = lifecycleRuleFromSDK(rule)
+	}
+	return rules, nil
+}
+
+// PutBucketLifecycle replaces all lifecycle rules of the bucket. Rules with
+// validation errors are rejected before anything is sent; warnings are
+// logged.
+func (s *S3Base) PutBucketLifecycle(bucketName string, rules []LifecycleRule) error {
+	var errs []string
+	for _, issue := range ValidateLifecycleRules(rules) {
+		if issue.Level == IssueError {
+			errs = append(errs, issue.String())
+		} else {
+			log.Printf("Lifecycle rule warning for bucket %v: %v\n", bucketName, issue)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New("invalid lifecycle rules: " + strings.Join(errs, "; "))
+	}
+
+	sdkRules := make([]types.LifecycleRule, len(rules))
+	for i := range rules {
+		sdkRules[i] = rules[i].toSDK()
+	}
+	_, err := s.S3Client.PutBucketLifecycleConfiguration(context.TODO(), &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(bucketName),
+		LifecycleConfiguration: &types.BucketLifecycleConfiguration{Rules: sdkRules},
+	})
+	if err != nil {
+		log.Printf("Couldn't put lifecycle rules on bucket %v. Here's why: %v\n", bucketName, err)
+	}
+	return err
+}
+
+func (s *S3Base) DeleteBucketLifecycle(bucketName string) error {
+	_, err := s.S3Client.DeleteBucketLifecycle(context.TODO(), &s3.DeleteBucketLifecycleInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		log.Printf("Couldn't delete lifecycle rules of bucket %v. Here's why: %v\n", bucketName, err)
+	}
+	return err
+}
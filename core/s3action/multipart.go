@@ -0,0 +1,215 @@
+package s3action
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	MinPartSize  int64 = 5 * 1024 * 1024
+	MaxPartSize  int64 = 5 * 1024 * 1024 * 1024
+	MaxPartCount       = 10000
+)
+
+// PresignedMultipartUpload is handed to a client that uploads the parts
+// itself. Each part URL is signed for its exact Content-Length.
+type PresignedMultipartUpload struct {
+	Bucket     string
+	Key        string
+	UploadId   string
+	ObjectSize int64
+	PartSize   int64
+	Expires    time.Time
+	Parts      []PresignedPart
+}
+
+type PresignedPart struct {
+	PartNumber int32
+	Size       int64
+	Request    *PresignedRequest
+}
+
+// UploadedPart is what the client reports back after uploading a part.
+type UploadedPart struct {
+	PartNumber int32
+	ETag       string
+}
+
+func PlanParts(objectSize, partSize int64) ([]int64, error) {
+	if objectSize <= 0 {
+		return nil, fmt.Errorf("object size must be positive, got %d", objectSize)
+	}
+	if partSize < MinPartSize || partSize > MaxPartSize {
+		return nil, fmt.Errorf("part size %d is outside %d-%d", partSize, MinPartSize, MaxPartSize)
+	}
+	count := (objectSize + partSize - 1) / partSize
+	if count > MaxPartCount {
+		return nil, fmt.Errorf("object of %d bytes needs %d parts of %d bytes, more than %d",
+			objectSize, count, partSize, MaxPartCount)
+	}
+	sizes := make([]int64, count)
+	for i := range sizes {
+		sizes[i] = partSize
+	}
+	sizes[count-1] = objectSize - partSize*(count-1)
+	return sizes, nil
+}
+
+func (s *S3Base) CreatePresignedMultipartUpload(bucketName, objectKey string, objectSize, partSize int64, expires time.Duration, encryption *Encryption) (*PresignedMultipartUpload, error) {
+	sizes, err := PlanParts(objectSize, partSize)
+	if err != nil {
+		return nil, err
+	}
+	// Check the expiry and encryption before the upload exists, so a bad
+	// value can't leave an orphaned upload behind.
+	if _, err := presignExpires(expires); err != nil {
+		return nil, err
+	}
+	if err := encryption.Validate(); err != nil {
+		return nil, err
+	}
+	if expires == 0 {
+		expires = DefaultPresignExpires
+	}
+
+	input := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectKey),
+	}
+	encryption.applyCreateMultipart(input)
+	output, err := s.S3Client.CreateMultipartUpload(context.TODO(), input)
+	if err != nil {
+		log.Printf("Couldn't create multipart upload for %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+		return nil, err
+	}
+
+	upload := &PresignedMultipartUpload{
+		Bucket:     bucketName,
+		Key:        objectKey,
+		UploadId:   *output.UploadId,
+		ObjectSize: objectSize,
+		PartSize:   partSize,
+		Expires:    time.Now().Add(expires),
+	}
+	for i, size := range sizes {
+		partNumber := int32(i + 1)
+		req, err := s.PresignUploadPart(bucketName, objectKey, upload.UploadId, partNumber,
+			PresignPutOptions{Expires: expires, ContentLength: size, Encryption: encryption})
+		if err != nil {
+			if abortErr := s.AbortMultipartUpload(bucketName, objectKey, upload.UploadId); abortErr != nil {
+				log.Printf("Couldn't abort multipart upload %v after presign failure: %v\n", upload.UploadId, abortErr)
+			}
+			return nil, err
+		}
+		upload.Parts = append(upload.Parts, PresignedPart{PartNumber: partNumber, Size: size, Request: req})
+	}
+	return upload, nil
+}
+
+// ValidateUploadedParts checks that the client reported every planned part
+// exactly once and that each ETag is present.
+func (u *PresignedMultipartUpload) ValidateUploadedParts(parts []UploadedPart) error {
+	if len(parts) != len(u.Parts) {
+		return fmt.Errorf("expected %d parts, got %d", len(u.Parts), len(parts))
+	}
+	seen := make(map[int32]bool, len(parts))
+	for _, part := range parts {
+		if part.PartNumber < 1 || int(part.PartNumber) > len(u.Parts) {
+			return fmt.Errorf("part number %d is outside 1-%d", part.PartNumber, len(u.Parts))
+		}
+		if seen[part.PartNumber] {
+			return fmt.Errorf("part number %d reported more than once", part.PartNumber)
+		}
+		if strings.Trim(part.ETag, `"`) == "" {
+			return fmt.Errorf("part number %d has no ETag", part.PartNumber)
+		}
+		seen[part.PartNumber] = true
+	}
+	return nil
+}
+
+func (s *S3Base) CompletePresignedMultipartUpload(upload *PresignedMultipartUpload, parts []UploadedPart) error {
+	if err := upload.ValidateUploadedParts(parts); err != nil {
+		log.Printf("Couldn't complete multipart upload %v. Here's why: %v\n", upload.UploadId, err)
+		return err
+	}
+
+	uploaded, err := s.ListUploadedParts(upload.Bucket, upload.Key, upload.UploadId)
+	if err != nil {
+		return err
+	}
+	stored := make(map[int32]types.Part, len(uploaded))
+	for _, part := range uploaded {
+		stored[part.PartNumber] = part
+	}
+	for _, part := range parts {
+		s3Part, ok := stored[part.PartNumber]
+		if !ok {
+			return fmt.Errorf("part number %d was not uploaded", part.PartNumber)
+		}
+		if expected := upload.Parts[part.PartNumber-1].Size; s3Part.Size != expected {
+			return fmt.Errorf("part number %d has %d bytes, expected %d", part.PartNumber, s3Part.Size, expected)
+		}
+		if strings.Trim(aws.ToString(s3Part.ETag), `"`) != strings.Trim(part.ETag, `"`) {
+			return fmt.Errorf("part number %d ETag %v does not match uploaded %v",
+				part.PartNumber, part.ETag, aws.ToString(s3Part.ETag))
+		}
+	}
+
+	completed := make([]types.CompletedPart, len(parts))
+	for i, part := range parts {
+		completed[i] = types.CompletedPart{PartNumber: part.PartNumber, ETag: aws.String(part.ETag)}
+	}
+	sort.Slice(completed, func(i, j int) bool { return completed[i].PartNumber < completed[j].PartNumber })
+
+	_, err = s.S3Client.CompleteMultipartUpload(context.TODO(), &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(upload.Bucket),
+		Key:             aws.String(upload.Key),
+		UploadId:        aws.String(upload.UploadId),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		log.Printf("Couldn't complete multipart upload %v for %v:%v. Here's why: %v\n",
+			upload.UploadId, upload.Bucket, upload.Key, err)
+	}
+	return err
+}
+
+func (s *S3Base) ListUploadedParts(bucketName, objectKey, uploadId string) ([]types.Part, error) {
+	var parts []types.Part
+	paginator := s3.NewListPartsPaginator(s.S3Client, &s3.ListPartsInput{
+		Bucket:   aws.String(bucketName),
+		Key:      aws.String(objectKey),
+		UploadId: aws.String(uploadId),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("Couldn't list parts of upload %v. Here's why: %v\n", uploadId, err)
+			return nil, err
+		}
+		parts = append(parts, page.Parts...)
+	}
+	return parts, nil
+}
+
+func (s *S3Base) AbortMultipartUpload(bucketName, objectKey, uploadId string) error {
+	_, err := s.S3Client.AbortMultipartUpload(context.TODO(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucketName),
+		Key:      aws.String(objectKey),
+		UploadId: aws.String(uploadId),
+	})
+	if err != nil {
+		log.Printf("Couldn't abort multipart upload %v for %v:%v. Here's why: %v\n",
+			uploadId, bucketName, objectKey, err)
+	}
+	return err
+}
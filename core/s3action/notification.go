@@ -0,0 +1,367 @@
+package s3action
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type NotificationTargetType string
+
+const (
+	TargetQueue  NotificationTargetType = "SQS"
+	TargetTopic  NotificationTargetType = "SNS"
+	TargetLambda NotificationTargetType = "Lambda"
+)
+
+// Event types for notification configurations. The SDK only lists them via
+// types.Event.Values.
+const (
+	EventObjectCreated                types.Event = "s3:ObjectCreated:*"
+	EventObjectCreatedPut             types.Event = "s3:ObjectCreated:Put"
+	EventObjectCreatedPost            types.Event = "s3:ObjectCreated:Post"
+	EventObjectCreatedCopy            types.Event = "s3:ObjectCreated:Copy"
+	EventObjectCreatedMultipartUpload types.Event = "s3:ObjectCreated:CompleteMultipartUpload"
+	EventObjectRemoved                types.Event = "s3:ObjectRemoved:*"
+	EventObjectRemovedDelete          types.Event = "s3:ObjectRemoved:Delete"
+	EventObjectRemovedDeleteMarker    types.Event = "s3:ObjectRemoved:DeleteMarkerCreated"
+	EventObjectRestore                types.Event = "s3:ObjectRestore:*"
+	EventObjectTagging                types.Event = "s3:ObjectTagging:*"
+	EventObjectAcl                    types.Event = "s3:ObjectAcl:Put"
+	EventLifecycleExpiration          types.Event = "s3:LifecycleExpiration:*"
+	EventReducedRedundancyLostObject  types.Event = "s3:ReducedRedundancyLostObject"
+)
+
+// NotificationTarget sends Events for keys matching Prefix and Suffix to an
+// SQS queue, SNS topic or Lambda function.
+type NotificationTarget struct {
+	ID     string
+	Type   NotificationTargetType
+	Arn    string
+	Events []types.Event
+	Prefix string
+	Suffix string
+}
+
+func QueueNotification(queueArn string, events ...types.Event) *NotificationTarget {
+	return &NotificationTarget{Type: TargetQueue, Arn: queueArn, Events: events}
+}
+
+func TopicNotification(topicArn string, events ...types.Event) *NotificationTarget {
+	return &NotificationTarget{Type: TargetTopic, Arn: topicArn, Events: events}
+}
+
+func LambdaNotification(functionArn string, events ...types.Event) *NotificationTarget {
+	return &NotificationTarget{Type: TargetLambda, Arn: functionArn, Events: events}
+}
+
+func (t *NotificationTarget) WithID(id string) *NotificationTarget {
+	t.ID = id
+	return t
+}
+
+func (t *NotificationTarget) WithPrefix(prefix string) *NotificationTarget {
+	t.Prefix = prefix
+	return t
+}
+
+func (t *NotificationTarget) WithSuffix(suffix string) *NotificationTarget {
+	t.Suffix = suffix
+	return t
+}
+
+type NotificationConfig struct {
+	Targets     []NotificationTarget
+	EventBridge bool
+}
+
+// ValidateNotificationConfig checks what S3 would reject: targets without
+// an ARN or events, and two targets that could both receive the same event
+// for the same key.
+func ValidateNotificationConfig(config NotificationConfig) error {
+	for i, t := range config.Targets {
+		switch {
+		case t.Type != TargetQueue && t.Type != TargetTopic && t.Type != TargetLambda:
+			return fmt.Errorf("notification %d: unknown target type %q", i, t.Type)
+		case t.Arn == "":
+			return fmt.Errorf("notification %d has no ARN", i)
+		case len(t.Events) == 0:
+			return fmt.Errorf("notification %d has no events", i)
+		}
+		for j := 0; j < i; j++ {
+			if notificationsOverlap(config.Targets[j], t) {
+				return fmt.Errorf("notifications %d and %d overlap on events and key filters", j, i)
+			}
+		}
+	}
+	return nil
+}
+
+func notificationsOverlap(a, b NotificationTarget) bool {
+	if !strings.HasPrefix(a.Prefix, b.Prefix) && !strings.HasPrefix(b.Prefix, a.Prefix) {
+		return false
+	}
+	if !strings.HasSuffix(a.Suffix, b.Suffix) && !strings.HasSuffix(b.Suffix, a.Suffix) {
+		return false
+	}
+	for _, x := range a.Events {
+		for _, y := range b.Events {
+			if WildcardMatch(string(x), string(y)) || WildcardMatch(string(y), string(x)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (t NotificationTarget) filter() *types.NotificationConfigurationFilter {
+	var rules []types.FilterRule
+	if t.Prefix != "" {
+		rules = append(rules, types.FilterRule{Name: types.FilterRuleNamePrefix, Value: aws.String(t.Prefix)})
+	}
+	if t.Suffix != "" {
+		rules = append(rules, types.FilterRule{Name: types.FilterRuleNameSuffix, Value: aws.String(t.Suffix)})
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	return &types.NotificationConfigurationFilter{Key: &types.S3KeyFilter{FilterRules: rules}}
+}
+
+func newNotificationTarget(targetType NotificationTargetType, id, arn *string, events []types.Event, filter *types.NotificationConfigurationFilter) NotificationTarget {
+	t := NotificationTarget{ID: aws.ToString(id), Type: targetType, Arn: aws.ToString(arn), Events: events}
+	if filter != nil && filter.Key != nil {
+		for _, rule := range filter.Key.FilterRules {
+			switch strings.ToLower(string(rule.Name)) {
+			case string(types.FilterRuleNamePrefix):
+				t.Prefix = aws.ToString(rule.Value)
+			case string(types.FilterRuleNameSuffix):
+				t.Suffix = aws.ToString(rule.Value)
+			}
+		}
+	}
+	return t
+}
+
+func (s *S3Base) GetBucketNotifications(bucketName string) (*NotificationConfig, error) {
+	output, err := s.S3Client.GetBucketNotificationConfiguration(context.TODO(), &s3.GetBucketNotificationConfigurationInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		log.Printf("Couldn't get notifications of bucket %v. Here's why: %v\n", bucketName, err)
+		return nil, err
+	}
+	config := &NotificationConfig{EventBridge: output.EventBridgeConfiguration != nil}
+	for _, c := range output.QueueConfigurations {
+		config.Targets = append(config.Targets, newNotificationTarget(TargetQueue, c.Id, c.QueueArn, c.Events, c.Filter))
+	}
+	for _, c := range output.TopicConfigurations {
+		config.Targets = append(config.Targets, newNotificationTarget(TargetTopic, c.Id, c.TopicArn, c.Events, c.Filter))
+	}
+	for _, c := range output.LambdaFunctionConfigurations {
+		config.Targets = append(config.Targets, newNotificationTarget(TargetLambda, c.Id, c.LambdaFunctionArn, c.Events, c.Filter))
+	}
+	return config, nil
+}
+
+// PutBucketNotifications replaces the bucket's notification configuration.
+// S3 sends a test event to every new target, so the queues, topics and
+// functions must already allow S3 to publish to them.
+func (s *S3Base) PutBucketNotifications(bucketName string, config NotificationConfig) error {
+	if err := ValidateNotificationConfig(config); err != nil {
+		return err
+	}
+	notification := &types.NotificationConfiguration{}
+	if config.EventBridge {
+		notification.EventBridgeConfiguration = &types.EventBridgeConfiguration{}
+	}
+	for _, t := range config.Targets {
+		switch t.Type {
+		case TargetQueue:
+			notification.QueueConfigurations = append(notification.QueueConfigurations, types.QueueConfiguration{
+				Id: optionalString(t.ID), QueueArn: aws.String(t.Arn), Events: t.Events, Filter: t.filter(),
+			})
+		case TargetTopic:
+			notification.TopicConfigurations = append(notification.TopicConfigurations, types.TopicConfiguration{
+				Id: optionalString(t.ID), TopicArn: aws.String(t.Arn), Events: t.Events, Filter: t.filter(),
+			})
+		case TargetLambda:
+			notification.LambdaFunctionConfigurations = append(notification.LambdaFunctionConfigurations, types.LambdaFunctionConfiguration{
+				Id: optionalString(t.ID), LambdaFunctionArn: aws.String(t.Arn), Events: t.Events, Filter: t.filter(),
+			})
+		}
+	}
+	_, err := s.S3Client.PutBucketNotificationConfiguration(context.TODO(), &s3.PutBucketNotificationConfigurationInput{
+		Bucket:                    aws.String(bucketName),
+		NotificationConfiguration: notification,
+	})
+	if err != nil {
+		log.Printf("Couldn't put notifications on bucket %v. Here's why: %v\n", bucketName, err)
+	}
+	return err
+}
+
+func (s *S3Base) DeleteBucketNotifications(bucketName string) error {
+	return s.PutBucketNotifications(bucketName, NotificationConfig{})
+}
+
+// S3Event is the notification payload S3 sends. TestEvent is set for the
+// s3:TestEvent message S3 sends when a configuration is saved; it has no
+// records.
+type S3Event struct {
+	Records   []S3EventRecord `json:"Records"`
+	TestEvent bool            `json:"-"`
+}
+
+type S3EventRecord struct {
+	EventVersion      string            `json:"eventVersion"`
+	EventSource       string            `json:"eventSource"`
+	AwsRegion         string            `json:"awsRegion"`
+	EventTime         time.Time         `json:"eventTime"`
+	EventName         string            `json:"eventName"`
+	UserIdentity      S3UserIdentity    `json:"userIdentity"`
+	RequestParameters map[string]string `json:"requestParameters"`
+	ResponseElements  map[string]string `json:"responseElements"`
+	S3                S3Entity          `json:"s3"`
+}
+
+type S3UserIdentity struct {
+	PrincipalID string `json:"principalId"`
+}
+
+type S3Entity struct {
+	SchemaVersion   string        `json:"s3SchemaVersion"`
+	ConfigurationID string        `json:"configurationId"`
+	Bucket          S3EventBucket `json:"bucket"`
+	Object          S3EventObject `json:"object"`
+}
+
+type S3EventBucket struct {
+	Name          string         `json:"name"`
+	OwnerIdentity S3UserIdentity `json:"ownerIdentity"`
+	Arn           string         `json:"arn"`
+}
+
+// S3EventObject describes the object. Key is URL-decoded by ParseS3Event.
+type S3EventObject struct {
+	Key       string `json:"key"`
+	Size      int64  `json:"size"`
+	ETag      string `json:"eTag"`
+	VersionID string `json:"versionId"`
+	Sequencer string `json:"sequencer"`
+}
+
+// Type returns the event type in the form used in the configuration, e.g.
+// "s3:ObjectCreated:Put".
+func (r S3EventRecord) Type() types.Event {
+	return types.Event("s3:" + r.EventName)
+}
+
+// ParseS3Event decodes an S3 notification, either as S3 sends it to SQS and
+// Lambda or wrapped in an SNS message.
+func ParseS3Event(data []byte) (*S3Event, error) {
+	var envelope struct {
+		Type    string
+		Message string
+		Event   string
+		Records json.RawMessage
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("parse S3 event: %w", err)
+	}
+	if envelope.Type == "Notification" && envelope.Message != "" {
+		return ParseS3Event([]byte(envelope.Message))
+	}
+	if envelope.Event == "s3:TestEvent" {
+		return &S3Event{TestEvent: true}, nil
+	}
+	if envelope.Records == nil || string(envelope.Records) == "null" {
+		return nil, errors.New("parse S3 event: no Records")
+	}
+
+	event := &S3Event{}
+	if err := json.Unmarshal(data, event); err != nil {
+		return nil, fmt.Errorf("parse S3 event: %w", err)
+	}
+	for i := range event.Records {
+		object := &event.Records[i].S3.Object
+		key, err := url.QueryUnescape(object.Key)
+		if err != nil {
+			return nil, fmt.Errorf("parse S3 event: record %d key %q: %w", i, object.Key, err)
+		}
+		object.Key = key
+	}
+	return event, nil
+}
+
+type EventHandler func(ctx context.Context, record S3EventRecord) error
+
+// EventDispatcher routes event records to handlers by event type. Patterns
+// use the configuration form and may end in a wildcard, e.g.
+// "s3:ObjectCreated:*".
+type EventDispatcher struct {
+	handlers []eventRoute
+	fallback EventHandler
+}
+
+type eventRoute struct {
+	pattern string
+	handler EventHandler
+}
+
+func NewEventDispatcher() *EventDispatcher {
+	return &EventDispatcher{}
+}
+
+func (d *EventDispatcher) Handle(pattern types.Event, handler EventHandler) *EventDispatcher {
+	d.handlers = append(d.handlers, eventRoute{pattern: string(pattern), handler: handler})
+	return d
+}
+
+// HandleUnmatched sets the handler for records no pattern matches. Without
+// one such records are skipped.
+func (d *EventDispatcher) HandleUnmatched(handler EventHandler) *EventDispatcher {
+	d.fallback = handler
+	return d
+}
+
+// Dispatch calls every matching handler for every record. All records are
+// processed; the first handler error is returned.
+func (d *EventDispatcher) Dispatch(ctx context.Context, event *S3Event) error {
+	var firstErr error
+	for _, record := range event.Records {
+		matched := false
+		for _, route := range d.handlers {
+			if !WildcardMatch(route.pattern, string(record.Type())) {
+				continue
+			}
+			matched = true
+			if err := route.handler(ctx, record); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("%v %v/%v: %w", record.EventName, record.S3.Bucket.Name, record.S3.Object.Key, err)
+			}
+		}
+		if !matched && d.fallback != nil {
+			if err := d.fallback(ctx, record); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("%v %v/%v: %w", record.EventName, record.S3.Bucket.Name, record.S3.Object.Key, err)
+			}
+		}
+	}
+	return firstErr
+}
+
+func (d *EventDispatcher) DispatchJSON(ctx context.Context, data []byte) error {
+	event, err := ParseS3Event(data)
+	if err != nil {
+		return err
+	}
+	return d.Dispatch(ctx, event)
+}
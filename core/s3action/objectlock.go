@@ -0,0 +1,254 @@
+package s3action
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ObjectRetention keeps an object version from being deleted or overwritten
+// until RetainUntil. Governance retention can be bypassed with the
+// s3:BypassGovernanceRetention permission; compliance retention cannot.
+type ObjectRetention struct {
+	Mode        types.ObjectLockRetentionMode
+	RetainUntil time.Time
+}
+
+func GovernanceRetention(retainUntil time.Time) ObjectRetention {
+	return ObjectRetention{Mode: types.ObjectLockRetentionModeGovernance, RetainUntil: retainUntil}
+}
+
+func ComplianceRetention(retainUntil time.Time) ObjectRetention {
+	return ObjectRetention{Mode: types.ObjectLockRetentionModeCompliance, RetainUntil: retainUntil}
+}
+
+func validateRetentionMode(mode types.ObjectLockRetentionMode) error {
+	switch mode {
+	case types.ObjectLockRetentionModeGovernance, types.ObjectLockRetentionModeCompliance:
+		return nil
+	}
+	return fmt.Errorf("unknown retention mode %q", mode)
+}
+
+func (r ObjectRetention) Validate() error {
+	if err := validateRetentionMode(r.Mode); err != nil {
+		return err
+	}
+	if r.RetainUntil.IsZero() {
+		return errors.New("retention has no retain-until date")
+	}
+	return nil
+}
+
+// DefaultRetention is applied to new object versions that are uploaded
+// without their own retention. Exactly one of Days and Years must be set.
+type DefaultRetention struct {
+	Mode  types.ObjectLockRetentionMode
+	Days  int32
+	Years int32
+}
+
+func (r DefaultRetention) Validate() error {
+	if err := validateRetentionMode(r.Mode); err != nil {
+		return err
+	}
+	if (r.Days > 0) == (r.Years > 0) {
+		return errors.New("default retention needs either Days or Years")
+	}
+	return nil
+}
+
+type ObjectLockConfiguration struct {
+	Enabled          bool
+	DefaultRetention *DefaultRetention
+}
+
+func WithObjectLock() BucketOption {
+	return func(o *BucketOptions) {
+		o.ObjectLock = true
+	}
+}
+
+// WithRetention uploads the object with its own retention period.
+func WithRetention(retention ObjectRetention) PutOption {
+	return func(o *PutOptions) {
+		o.Retention = &retention
+	}
+}
+
+func WithLegalHold() PutOption {
+	return func(o *PutOptions) {
+		o.LegalHold = true
+	}
+}
+
+type LockOptions struct {
+	BypassGovernance bool
+}
+
+type LockOption func(*LockOptions)
+
+// WithBypassGovernance lets a delete or retention change go through
+// governance mode retention.
+func WithBypassGovernance() LockOption {
+	return func(o *LockOptions) {
+		o.BypassGovernance = true
+	}
+}
+
+func newLockOptions(opts []LockOption) *LockOptions {
+	lockOptions := &LockOptions{}
+	for _, opt := range opts {
+		opt(lockOptions)
+	}
+	return lockOptions
+}
+
+func (s *S3Base) GetObjectLockConfiguration(bucketName string) (*ObjectLockConfiguration, error) {
+	output, err := s.S3Client.GetObjectLockConfiguration(context.TODO(), &s3.GetObjectLockConfigurationInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		if apiErrorCode(err) == "ObjectLockConfigurationNotFoundError" {
+			return &ObjectLockConfiguration{}, nil
+		}
+		log.Printf("Couldn't get object lock configuration of bucket %v. Here's why: %v\n", bucketName, err)
+		return nil, err
+	}
+	config := &ObjectLockConfiguration{}
+	if lock := output.ObjectLockConfiguration; lock != nil {
+		config.Enabled = lock.ObjectLockEnabled == types.ObjectLockEnabledEnabled
+		if lock.Rule != nil && lock.Rule.DefaultRetention != nil {
+			config.DefaultRetention = &DefaultRetention{
+				Mode:  lock.Rule.DefaultRetention.Mode,
+				Days:  lock.Rule.DefaultRetention.Days,
+				Years: lock.Rule.DefaultRetention.Years,
+			}
+		}
+	}
+	return config, nil
+}
+
+// PutDefaultRetention sets the bucket's default retention, or removes it
+// when retention is nil. Object Lock must be enabled on the bucket.
+func (s *S3Base) PutDefaultRetention(bucketName string, retention *DefaultRetention) error {
+	lock := &types.ObjectLockConfiguration{ObjectLockEnabled: types.ObjectLockEnabledEnabled}
+	if retention != nil {
+		if err := retention.Validate(); err != nil {
+			return err
+		}
+		lock.Rule = &types.ObjectLockRule{DefaultRetention: &types.DefaultRetention{
+			Mode:  retention.Mode,
+			Days:  retention.Days,
+			Years: retention.Years,
+		}}
+	}
+	_, err := s.S3Client.PutObjectLockConfiguration(context.TODO(), &s3.PutObjectLockConfigurationInput{
+		Bucket:                  aws.String(bucketName),
+		ObjectLockConfiguration: lock,
+	})
+	if err != nil {
+		log.Printf("Couldn't put object lock configuration on bucket %v. Here's why: %v\n", bucketName, err)
+	}
+	return err
+}
+
+// GetObjectRetention returns nil if the version has no retention. An empty
+// versionId means the current version.
+func (s *S3Base) GetObjectRetention(bucketName, objectKey, versionId string) (*ObjectRetention, error) {
+	output, err := s.S3Client.GetObjectRetention(context.TODO(), &s3.GetObjectRetentionInput{
+		Bucket:    aws.String(bucketName),
+		Key:       aws.String(objectKey),
+		VersionId: optionalString(versionId),
+	})
+	if err != nil {
+		if apiErrorCode(err) == "NoSuchObjectLockConfiguration" {
+			return nil, nil
+		}
+		log.Printf("Couldn't get retention of object %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+		return nil, err
+	}
+	if output.Retention == nil || output.Retention.Mode == "" {
+		return nil, nil
+	}
+	return &ObjectRetention{
+		Mode:        output.Retention.Mode,
+		RetainUntil: aws.ToTime(output.Retention.RetainUntilDate),
+	}, nil
+}
+
+// PutObjectRetention sets or extends the retention of a version. Shortening
+// or removing governance retention needs WithBypassGovernance.
+func (s *S3Base) PutObjectRetention(bucketName, objectKey, versionId string, retention ObjectRetention, opts ...LockOption) error {
+	if err := retention.Validate(); err != nil {
+		return err
+	}
+	_, err := s.S3Client.PutObjectRetention(context.TODO(), &s3.PutObjectRetentionInput{
+		Bucket:    aws.String(bucketName),
+		Key:       aws.String(objectKey),
+		VersionId: optionalString(versionId),
+		Retention: &types.ObjectLockRetention{
+			Mode:            retention.Mode,
+			RetainUntilDate: aws.Time(retention.RetainUntil),
+		},
+		BypassGovernanceRetention: newLockOptions(opts).BypassGovernance,
+	})
+	if err != nil {
+		log.Printf("Couldn't put retention on object %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+	}
+	return err
+}
+
+func (s *S3Base) GetObjectLegalHold(bucketName, objectKey, versionId string) (bool, error) {
+	output, err := s.S3Client.GetObjectLegalHold(context.TODO(), &s3.GetObjectLegalHoldInput{
+		Bucket:    aws.String(bucketName),
+		Key:       aws.String(objectKey),
+		VersionId: optionalString(versionId),
+	})
+	if err != nil {
+		if apiErrorCode(err) == "NoSuchObjectLockConfiguration" {
+			return false, nil
+		}
+		log.Printf("Couldn't get legal hold of object %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+		return false, err
+	}
+	return output.LegalHold != nil && output.LegalHold.Status == types.ObjectLockLegalHoldStatusOn, nil
+}
+
+func (s *S3Base) PutObjectLegalHold(bucketName, objectKey, versionId string, on bool) error {
+	status := types.ObjectLockLegalHoldStatusOff
+	if on {
+		status = types.ObjectLockLegalHoldStatusOn
+	}
+	_, err := s.S3Client.PutObjectLegalHold(context.TODO(), &s3.PutObjectLegalHoldInput{
+		Bucket:    aws.String(bucketName),
+		Key:       aws.String(objectKey),
+		VersionId: optionalString(versionId),
+		LegalHold: &types.ObjectLockLegalHold{Status: status},
+	})
+	if err != nil {
+		log.Printf("Couldn't put legal hold %v on object %v:%v. Here's why: %v\n", status, bucketName, objectKey, err)
+	}
+	return err
+}
+
+// applyPut sets the lock headers. S3 requires a checksum on uploads that
+// carry Object Lock settings, so one is requested when none is set.
+func (r *ObjectRetention) applyPut(input *s3.PutObjectInput, legalHold bool) {
+	if r != nil {
+		input.ObjectLockMode = types.ObjectLockMode(r.Mode)
+		input.ObjectLockRetainUntilDate = aws.Time(r.RetainUntil)
+	}
+	if legalHold {
+		input.ObjectLockLegalHoldStatus = types.ObjectLockLegalHoldStatusOn
+	}
+	if (r != nil || legalHold) && input.ChecksumAlgorithm == "" && input.ContentMD5 == nil {
+		input.ChecksumAlgorithm = types.ChecksumAlgorithmCrc32
+	}
+}
@@ -0,0 +1,229 @@
+package s3action
+
+import (
+	"context"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// PutOptions holds the headers sent with an upload. When ContentType is
+// empty it is detected from the key extension, then by sniffing the body.
+type PutOptions struct {
+	ContentType        string
+	CacheControl       string
+	ContentDisposition string
+	ContentEncoding    string
+	ContentLanguage    string
+	Expires            *time.Time
+	Metadata           map[string]string
+	Tags               map[string]string
+	Encryption         *Encryption
+	Compression        *CompressionPolicy
+	Retention          *ObjectRetention
+	LegalHold          bool
+	acl                types.ObjectCannedACL
+}
+
+type PutOption func(*PutOptions)
+
+func WithContentType(contentType string) PutOption {
+	return func(o *PutOptions) {
+		o.ContentType = contentType
+	}
+}
+
+func WithCacheControl(cacheControl string) PutOption {
+	return func(o *PutOptions) {
+		o.CacheControl = cacheControl
+	}
+}
+
+func WithContentDisposition(contentDisposition string) PutOption {
+	return func(o *PutOptions) {
+		o.ContentDisposition = contentDisposition
+	}
+}
+
+func WithContentEncoding(contentEncoding string) PutOption {
+	return func(o *PutOptions) {
+		o.ContentEncoding = contentEncoding
+	}
+}
+
+func WithContentLanguage(contentLanguage string) PutOption {
+	return func(o *PutOptions) {
+		o.ContentLanguage = contentLanguage
+	}
+}
+
+func WithExpires(expires time.Time) PutOption {
+	return func(o *PutOptions) {
+		o.Expires = &expires
+	}
+}
+
+// WithMetadata adds x-amz-meta-* user metadata. Names are stored lower case.
+func WithMetadata(metadata map[string]string) PutOption {
+	return func(o *PutOptions) {
+		if o.Metadata == nil {
+			o.Metadata = map[string]string{}
+		}
+		for name, value := range metadata {
+			o.Metadata[strings.ToLower(name)] = value
+		}
+	}
+}
+
+func newPutOptions(opts []PutOption) *PutOptions {
+	putOptions := &PutOptions{}
+	for _, opt := range opts {
+		opt(putOptions)
+	}
+	return putOptions
+}
+
+// validate checks the options that S3 would otherwise reject only after
+// the body has been sent.
+func (o *PutOptions) validate() error {
+	if err := o.Encryption.Validate(); err != nil {
+		return err
+	}
+	if o.Retention != nil {
+		return o.Retention.Validate()
+	}
+	return nil
+}
+
+func (o *PutOptions) compression(objectKey string) (Compression, bool) {
+	if o.Compression == nil || !o.Compression.ShouldCompress(objectKey) {
+		return "", false
+	}
+	return o.Compression.Algorithm, true
+}
+
+func (o *PutOptions) apply(input *s3.PutObjectInput) {
+	input.ContentType = optionalString(o.ContentType)
+	input.CacheControl = optionalString(o.CacheControl)
+	input.ContentDisposition = optionalString(o.ContentDisposition)
+	input.ContentEncoding = optionalString(o.ContentEncoding)
+	input.ContentLanguage = optionalString(o.ContentLanguage)
+	input.Expires = o.Expires
+	if len(o.Metadata) > 0 {
+		input.Metadata = o.Metadata
+	}
+	input.Tagging = encodeTagging(o.Tags)
+	o.Encryption.applyPut(input)
+	o.Retention.applyPut(input, o.LegalHold)
+	input.ACL = o.acl
+}
+
+// withCannedAcl is set by the public upload helper after the bucket has
+// been checked, so it is not exported as a regular option.
+func withCannedAcl(acl types.ObjectCannedACL) PutOption {
+	return func(o *PutOptions) {
+		o.acl = acl
+	}
+}
+
+func DetectContentType(objectKey string, head []byte) string {
+	if contentType := mime.TypeByExtension(filepath.Ext(objectKey)); contentType != "" {
+		return contentType
+	}
+	if len(head) > 0 {
+		return http.DetectContentType(head)
+	}
+	return "application/octet-stream"
+}
+
+// detectReaderContentType sniffs up to 512 bytes and rewinds the reader.
+func (o *PutOptions) detectReaderContentType(objectKey string, body io.ReadSeeker) error {
+	if o.ContentType != "" {
+		return nil
+	}
+	if contentType := mime.TypeByExtension(filepath.Ext(objectKey)); contentType != "" {
+		o.ContentType = contentType
+		return nil
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(body, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	o.ContentType = DetectContentType(objectKey, head[:n])
+	_, err = body.Seek(0, io.SeekStart)
+	return err
+}
+
+type ObjectInfo struct {
+	Key                  string
+	Size                 int64
+	ETag                 string
+	LastModified         time.Time
+	ContentType          string
+	CacheControl         string
+	ContentDisposition   string
+	ContentEncoding      string
+	ContentLanguage      string
+	Metadata             map[string]string
+	StorageClass         types.StorageClass
+	VersionId            string
+	DeleteMarker         bool
+	ServerSideEncryption types.ServerSideEncryption
+	SSEKMSKeyId          string
+	BucketKeyEnabled     bool
+}
+
+func (s *S3Base) StatObject(bucketName, objectKey string, opts ...GetOption) (*ObjectInfo, error) {
+	return s.statObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectKey),
+	}, opts)
+}
+
+func (s *S3Base) StatObjectByVersion(bucketName, objectKey, versionId string, opts ...GetOption) (*ObjectInfo, error) {
+	return s.statObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket:    aws.String(bucketName),
+		Key:       aws.String(objectKey),
+		VersionId: aws.String(versionId),
+	}, opts)
+}
+
+func (s *S3Base) statObject(ctx context.Context, input *s3.HeadObjectInput, opts []GetOption) (*ObjectInfo, error) {
+	newGetOptions(opts).applyHead(input)
+	output, err := s.S3Client.HeadObject(ctx, input)
+	if err != nil {
+		log.Printf("Couldn't head object %v:%v. Here's why: %v\n", *input.Bucket, *input.Key, err)
+		return nil, err
+	}
+	storageClass := output.StorageClass
+	if storageClass == "" {
+		storageClass = types.StorageClassStandard
+	}
+	return &ObjectInfo{
+		Key:                  *input.Key,
+		Size:                 output.ContentLength,
+		ETag:                 strings.Trim(aws.ToString(output.ETag), `"`),
+		LastModified:         aws.ToTime(output.LastModified),
+		ContentType:          aws.ToString(output.ContentType),
+		CacheControl:         aws.ToString(output.CacheControl),
+		ContentDisposition:   aws.ToString(output.ContentDisposition),
+		ContentEncoding:      aws.ToString(output.ContentEncoding),
+		ContentLanguage:      aws.ToString(output.ContentLanguage),
+		Metadata:             output.Metadata,
+		StorageClass:         storageClass,
+		VersionId:            aws.ToString(output.VersionId),
+		DeleteMarker:         output.DeleteMarker,
+		ServerSideEncryption: output.ServerSideEncryption,
+		SSEKMSKeyId:          aws.ToString(output.SSEKMSKeyId),
+		BucketKeyEnabled:     output.BucketKeyEnabled,
+	}, nil
+}
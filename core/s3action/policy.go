@@ -0,0 +1,311 @@
+package s3action
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const PolicyVersion = "2012-10-17"
+
+type PolicyEffect string
+
+const (
+	EffectAllow PolicyEffect = "Allow"
+	EffectDeny  PolicyEffect = "Deny"
+)
+
+// StringList is a policy value that may be written as a single string or a
+// list. Booleans and numbers, common in conditions, are kept as strings.
+type StringList []string
+
+func (l StringList) MarshalJSON() ([]byte, error) {
+	if len(l) == 1 {
+		return json.Marshal(l[0])
+	}
+	return json.Marshal([]string(l))
+}
+
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	values, ok := raw.([]interface{})
+	if !ok {
+		values = []interface{}{raw}
+	}
+	list := make(StringList, 0, len(values))
+	for _, value := range values {
+		switch v := value.(type) {
+		case string:
+			list = append(list, v)
+		case bool:
+			list = append(list, strconv.FormatBool(v))
+		case float64:
+			list = append(list, strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			return fmt.Errorf("unsupported policy value %v", value)
+		}
+	}
+	*l = list
+	return nil
+}
+
+// Principal is either everyone ("*") or a set of principals by type.
+type Principal struct {
+	All           bool
+	AWS           StringList
+	Service       StringList
+	Federated     StringList
+	CanonicalUser StringList
+}
+
+func AnyPrincipal() *Principal {
+	return &Principal{All: true}
+}
+
+func AWSPrincipal(arns ...string) *Principal {
+	return &Principal{AWS: arns}
+}
+
+type principalJSON struct {
+	AWS           StringList `json:"AWS,omitempty"`
+	Service       StringList `json:"Service,omitempty"`
+	Federated     StringList `json:"Federated,omitempty"`
+	CanonicalUser StringList `json:"CanonicalUser,omitempty"`
+}
+
+func (p Principal) MarshalJSON() ([]byte, error) {
+	if p.All {
+		return json.Marshal("*")
+	}
+	return json.Marshal(principalJSON{AWS: p.AWS, Service: p.Service, Federated: p.Federated, CanonicalUser: p.CanonicalUser})
+}
+
+func (p *Principal) UnmarshalJSON(data []byte) error {
+	var all string
+	if err := json.Unmarshal(data, &all); err == nil {
+		if all != "*" {
+			return fmt.Errorf("invalid principal %q", all)
+		}
+		*p = Principal{All: true}
+		return nil
+	}
+	var principals principalJSON
+	if err := json.Unmarshal(data, &principals); err != nil {
+		return err
+	}
+	*p = Principal{
+		AWS:           principals.AWS,
+		Service:       principals.Service,
+		Federated:     principals.Federated,
+		CanonicalUser: principals.CanonicalUser,
+	}
+	return nil
+}
+
+// PolicyConditions maps an operator such as "StringLike" to condition keys
+// and their allowed values.
+type PolicyConditions map[string]map[string]StringList
+
+type PolicyStatement struct {
+	Sid          string           `json:"Sid,omitempty"`
+	Effect       PolicyEffect     `json:"Effect"`
+	Principal    *Principal       `json:"Principal,omitempty"`
+	NotPrincipal *Principal       `json:"NotPrincipal,omitempty"`
+	Action       StringList       `json:"Action,omitempty"`
+	NotAction    StringList       `json:"NotAction,omitempty"`
+	Resource     StringList       `json:"Resource,omitempty"`
+	NotResource  StringList       `json:"NotResource,omitempty"`
+	Condition    PolicyConditions `json:"Condition,omitempty"`
+}
+
+type PolicyDocument struct {
+	Version   string            `json:"Version"`
+	Id        string            `json:"Id,omitempty"`
+	Statement []PolicyStatement `json:"Statement"`
+}
+
+func NewPolicyDocument() *PolicyDocument {
+	return &PolicyDocument{Version: PolicyVersion}
+}
+
+func ParsePolicyDocument(data []byte) (*PolicyDocument, error) {
+	// A policy may hold a single statement object instead of a list.
+	var raw struct {
+		Version   string          `json:"Version"`
+		Id        string          `json:"Id"`
+		Statement json.RawMessage `json:"Statement"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	doc := &PolicyDocument{Version: raw.Version, Id: raw.Id}
+	if len(raw.Statement) > 0 && raw.Statement[0] == '{' {
+		var statement PolicyStatement
+		if err := json.Unmarshal(raw.Statement, &statement); err != nil {
+			return nil, err
+		}
+		doc.Statement = []PolicyStatement{statement}
+	} else if len(raw.Statement) > 0 {
+		if err := json.Unmarshal(raw.Statement, &doc.Statement); err != nil {
+			return nil, err
+		}
+	}
+	return doc, doc.Validate()
+}
+
+func (d *PolicyDocument) JSON() (string, error) {
+	data, err := json.MarshalIndent(d, "", "  ")
+	return string(data), err
+}
+
+func (d *PolicyDocument) Validate() error {
+	if len(d.Statement) == 0 {
+		return errors.New("policy has no statements")
+	}
+	sids := map[string]int{}
+	for i, st := range d.Statement {
+		if st.Sid != "" {
+			if first, ok := sids[st.Sid]; ok {
+				return fmt.Errorf("statements %d and %d have the same Sid %q", first, i, st.Sid)
+			}
+			sids[st.Sid] = i
+		}
+		if st.Effect != EffectAllow && st.Effect != EffectDeny {
+			return fmt.Errorf("statement %d has invalid effect %q", i, st.Effect)
+		}
+		if (st.Principal == nil) == (st.NotPrincipal == nil) {
+			return fmt.Errorf("statement %d must have exactly one of Principal or NotPrincipal", i)
+		}
+		if (len(st.Action) == 0) == (len(st.NotAction) == 0) {
+			return fmt.Errorf("statement %d must have exactly one of Action or NotAction", i)
+		}
+		if (len(st.Resource) == 0) == (len(st.NotResource) == 0) {
+			return fmt.Errorf("statement %d must have exactly one of Resource or NotResource", i)
+		}
+	}
+	return nil
+}
+
+func (d *PolicyDocument) AddStatement(statement PolicyStatement) *PolicyDocument {
+	d.Statement = append(d.Statement, statement)
+	return d
+}
+
+func BucketArn(bucketName string) string {
+	return "arn:aws:s3:::" + bucketName
+}
+
+func ObjectArn(bucketName, keyPattern string) string {
+	return "arn:aws:s3:::" + bucketName + "/" + keyPattern
+}
+
+// prefixSid turns a key prefix into a Sid suffix. Sids may only hold
+// letters and digits, so "public/images/" becomes "PublicImages".
+func prefixSid(prefix string) string {
+	words := strings.FieldsFunc(prefix, func(r rune) bool {
+		return r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r))
+	})
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, "")
+}
+
+// AllowReadOnlyPrefix lets principal list and read objects under prefix.
+// The Sids include the prefix, so it can be called once per prefix.
+func (d *PolicyDocument) AllowReadOnlyPrefix(bucketName, prefix string, principal *Principal) *PolicyDocument {
+	suffix := prefixSid(prefix)
+	d.AddStatement(PolicyStatement{
+		Sid:       "ReadOnlyGetObjects" + suffix,
+		Effect:    EffectAllow,
+		Principal: principal,
+		Action:    StringList{"s3:GetObject", "s3:GetObjectVersion"},
+		Resource:  StringList{ObjectArn(bucketName, prefix+"*")},
+	})
+	return d.AddStatement(PolicyStatement{
+		Sid:       "ReadOnlyListPrefix" + suffix,
+		Effect:    EffectAllow,
+		Principal: principal,
+		Action:    StringList{"s3:ListBucket"},
+		Resource:  StringList{BucketArn(bucketName)},
+		Condition: PolicyConditions{"StringLike": {"s3:prefix": StringList{prefix + "*"}}},
+	})
+}
+
+func (d *PolicyDocument) DenyInsecureTransport(bucketName string) *PolicyDocument {
+	return d.AddStatement(PolicyStatement{
+		Sid:       "DenyInsecureTransport",
+		Effect:    EffectDeny,
+		Principal: AnyPrincipal(),
+		Action:    StringList{"s3:*"},
+		Resource:  StringList{BucketArn(bucketName), ObjectArn(bucketName, "*")},
+		Condition: PolicyConditions{"Bool": {"aws:SecureTransport": StringList{"false"}}},
+	})
+}
+
+// DenyUnencryptedUploads rejects PutObject requests that do not ask for
+// SSE-S3 or SSE-KMS, including requests without the header at all.
+func (d *PolicyDocument) DenyUnencryptedUploads(bucketName string) *PolicyDocument {
+	return d.AddStatement(PolicyStatement{
+		Sid:       "DenyUnencryptedUploads",
+		Effect:    EffectDeny,
+		Principal: AnyPrincipal(),
+		Action:    StringList{"s3:PutObject"},
+		Resource:  StringList{ObjectArn(bucketName, "*")},
+		Condition: PolicyConditions{"StringNotEquals": {"s3:x-amz-server-side-encryption": StringList{"AES256", "aws:kms"}}},
+	})
+}
+
+// GetBucketPolicy returns the bucket policy. A bucket without one returns
+// an error with the NoSuchBucketPolicy code, which is not logged.
+func (s *S3Base) GetBucketPolicy(bucketName string) (*PolicyDocument, error) {
+	output, err := s.S3Client.GetBucketPolicy(context.TODO(), &s3.GetBucketPolicyInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		if apiErrorCode(err) != "NoSuchBucketPolicy" {
+			log.Printf("Couldn't get policy of bucket %v. Here's why: %v\n", bucketName, err)
+		}
+		return nil, err
+	}
+	return ParsePolicyDocument([]byte(aws.ToString(output.Policy)))
+}
+
+func (s *S3Base) PutBucketPolicy(bucketName string, policy *PolicyDocument) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	document, err := policy.JSON()
+	if err != nil {
+		return err
+	}
+	_, err = s.S3Client.PutBucketPolicy(context.TODO(), &s3.PutBucketPolicyInput{
+		Bucket: aws.String(bucketName),
+		Policy: aws.String(document),
+	})
+	if err != nil {
+		log.Printf("Couldn't put policy on bucket %v. Here's why: %v\n", bucketName, err)
+	}
+	return err
+}
+
+func (s *S3Base) DeleteBucketPolicy(bucketName string) error {
+	_, err := s.S3Client.DeleteBucketPolicy(context.TODO(), &s3.DeleteBucketPolicyInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		log.Printf("Couldn't delete policy of bucket %v. Here's why: %v\n", bucketName, err)
+	}
+	return err
+}
@@ -0,0 +1,277 @@
+package s3action
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AccessRequest is the request context an offline policy evaluation is run
+// against. Context holds condition keys such as "aws:SourceIp" or
+// "aws:SecureTransport"; "aws:CurrentTime" defaults to now.
+type AccessRequest struct {
+	Principal string
+	Action    string
+	Resource  string
+	Context   map[string][]string
+}
+
+type Decision string
+
+const (
+	DecisionAllow        Decision = "Allow"
+	DecisionExplicitDeny Decision = "ExplicitDeny"
+	DecisionImplicitDeny Decision = "ImplicitDeny"
+)
+
+type StatementTrace struct {
+	Index   int
+	Sid     string
+	Effect  PolicyEffect
+	Matched bool
+	Reason  string
+}
+
+// EvaluationResult holds the decision and, unless the request was denied
+// implicitly, the index of the statement that decided it.
+type EvaluationResult struct {
+	Decision      Decision
+	DecidingIndex int
+	Trace         []StatementTrace
+}
+
+func (r EvaluationResult) Allowed() bool {
+	return r.Decision == DecisionAllow
+}
+
+// EvaluatePolicy applies the IAM evaluation order to a single policy: an
+// explicit deny wins over any allow, and no matching statement means an
+// implicit deny.
+func EvaluatePolicy(policy *PolicyDocument, req AccessRequest) (EvaluationResult, error) {
+	result := EvaluationResult{Decision: DecisionImplicitDeny, DecidingIndex: -1}
+	for i, st := range policy.Statement {
+		matched, reason, err := statementMatches(st, req)
+		if err != nil {
+			return result, fmt.Errorf("statement %d: %w", i, err)
+		}
+		result.Trace = append(result.Trace, StatementTrace{
+			Index: i, Sid: st.Sid, Effect: st.Effect, Matched: matched, Reason: reason,
+		})
+		if !matched {
+			continue
+		}
+		switch {
+		case st.Effect == EffectDeny && result.Decision != DecisionExplicitDeny:
+			result.Decision, result.DecidingIndex = DecisionExplicitDeny, i
+		case st.Effect == EffectAllow && result.Decision == DecisionImplicitDeny:
+			result.Decision, result.DecidingIndex = DecisionAllow, i
+		}
+	}
+	return result, nil
+}
+
+func statementMatches(st PolicyStatement, req AccessRequest) (bool, string, error) {
+	if st.Principal != nil && !principalMatches(st.Principal, req.Principal) {
+		return false, "principal does not match", nil
+	}
+	if st.NotPrincipal != nil && principalMatches(st.NotPrincipal, req.Principal) {
+		return false, "principal is excluded by NotPrincipal", nil
+	}
+	if len(st.Action) > 0 && !anyWildcardMatch(st.Action, req.Action, true) {
+		return false, "action does not match", nil
+	}
+	if len(st.NotAction) > 0 && anyWildcardMatch(st.NotAction, req.Action, true) {
+		return false, "action is excluded by NotAction", nil
+	}
+	if len(st.Resource) > 0 && !anyWildcardMatch(st.Resource, req.Resource, false) {
+		return false, "resource does not match", nil
+	}
+	if len(st.NotResource) > 0 && anyWildcardMatch(st.NotResource, req.Resource, false) {
+		return false, "resource is excluded by NotResource", nil
+	}
+	for operator, keys := range st.Condition {
+		for key, values := range keys {
+			ok, err := conditionMatches(operator, key, values, req)
+			if err != nil {
+				return false, "", err
+			}
+			if !ok {
+				return false, fmt.Sprintf("condition %s on %s is not met", operator, key), nil
+			}
+		}
+	}
+	return true, "matched", nil
+}
+
+func principalMatches(p *Principal, principal string) bool {
+	if p.All {
+		return true
+	}
+	for _, list := range []StringList{p.AWS, p.Service, p.Federated, p.CanonicalUser} {
+		for _, candidate := range list {
+			if candidate == "*" || candidate == principal || accountMatches(candidate, principal) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// accountMatches treats "123456789012" and "arn:aws:iam::123456789012:root"
+// as every principal in that account.
+func accountMatches(candidate, principal string) bool {
+	account := strings.TrimSuffix(strings.TrimPrefix(candidate, "arn:aws:iam::"), ":root")
+	if len(account) != 12 || strings.Contains(account, ":") {
+		return false
+	}
+	return strings.HasPrefix(principal, "arn:aws:iam::"+account+":") ||
+		strings.HasPrefix(principal, "arn:aws:sts::"+account+":") ||
+		principal == account
+}
+
+func anyWildcardMatch(patterns []string, value string, ignoreCase bool) bool {
+	for _, pattern := range patterns {
+		if ignoreCase {
+			if WildcardMatch(strings.ToLower(pattern), strings.ToLower(value)) {
+				return true
+			}
+		} else if WildcardMatch(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// WildcardMatch matches value against a pattern where * matches any
+// sequence and ? matches a single character.
+func WildcardMatch(pattern, value string) bool {
+	p, v := 0, 0
+	star, mark := -1, 0
+	for v < len(value) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == value[v]):
+			p++
+			v++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, v
+			p++
+		case star >= 0:
+			p = star + 1
+			mark++
+			v = mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+func conditionMatches(operator, key string, expected StringList, req AccessRequest) (bool, error) {
+	ifExists := strings.HasSuffix(operator, "IfExists")
+	base := strings.TrimSuffix(operator, "IfExists")
+
+	actual, present := req.Context[key]
+	if !present && key == "aws:CurrentTime" {
+		actual, present = []string{time.Now().UTC().Format(time.RFC3339)}, true
+	}
+
+	if base == "Null" {
+		want := len(expected) > 0 && strings.EqualFold(expected[0], "true")
+		return want == !present, nil
+	}
+
+	negated := strings.HasPrefix(base, "StringNot") || base == "NotIpAddress"
+	if !present {
+		return ifExists || negated, nil
+	}
+
+	var match func(actual, expected string) (bool, error)
+	switch base {
+	case "StringEquals", "StringNotEquals":
+		match = func(a, e string) (bool, error) { return a == e, nil }
+	case "StringEqualsIgnoreCase", "StringNotEqualsIgnoreCase":
+		match = func(a, e string) (bool, error) { return strings.EqualFold(a, e), nil }
+	case "StringLike", "StringNotLike":
+		match = func(a, e string) (bool, error) { return WildcardMatch(e, a), nil }
+	case "Bool":
+		match = func(a, e string) (bool, error) { return strings.EqualFold(a, e), nil }
+	case "IpAddress", "NotIpAddress":
+		match = ipMatches
+	case "DateGreaterThan", "DateGreaterThanEquals", "DateLessThan", "DateLessThanEquals":
+		match = func(a, e string) (bool, error) { return compareDates(base, a, e) }
+	default:
+		return false, fmt.Errorf("unsupported condition operator %q", operator)
+	}
+
+	for _, a := range actual {
+		for _, e := range expected {
+			ok, err := match(a, e)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				return !negated, nil
+			}
+		}
+	}
+	return negated, nil
+}
+
+func ipMatches(actual, expected string) (bool, error) {
+	ip := net.ParseIP(actual)
+	if ip == nil {
+		return false, fmt.Errorf("invalid IP address %q", actual)
+	}
+	if !strings.Contains(expected, "/") {
+		other := net.ParseIP(expected)
+		if other == nil {
+			return false, fmt.Errorf("invalid IP address %q", expected)
+		}
+		return other.Equal(ip), nil
+	}
+	_, network, err := net.ParseCIDR(expected)
+	if err != nil {
+		return false, err
+	}
+	return network.Contains(ip), nil
+}
+
+func parsePolicyDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+func compareDates(operator, actual, expected string) (bool, error) {
+	a, err := parsePolicyDate(actual)
+	if err != nil {
+		return false, err
+	}
+	e, err := parsePolicyDate(expected)
+	if err != nil {
+		return false, err
+	}
+	switch operator {
+	case "DateGreaterThan":
+		return a.After(e), nil
+	case "DateGreaterThanEquals":
+		return !a.Before(e), nil
+	case "DateLessThan":
+		return a.Before(e), nil
+	default:
+		return !a.After(e), nil
+	}
+}
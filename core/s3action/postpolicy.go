@@ -0,0 +1,227 @@
+package s3action
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const postPolicyAlgorithm = "AWS4-HMAC-SHA256"
+
+// PostPolicyBuilder collects the conditions of an S3 POST policy document
+// used for browser form uploads. Set methods can be chained; the first
+// invalid argument is kept and reported by Sign.
+type PostPolicyBuilder struct {
+	bucketName          string
+	expires             time.Duration
+	key                 string
+	keyPrefix           string
+	minContentLength    int64
+	maxContentLength    int64
+	hasContentLength    bool
+	contentType         string
+	contentTypePrefix   string
+	successActionStatus int
+	metadata            map[string]string
+	err                 error
+}
+
+type PresignedPost struct {
+	URL     string
+	Fields  map[string]string
+	Expires time.Time
+}
+
+func NewPostPolicy(bucketName string) *PostPolicyBuilder {
+	return &PostPolicyBuilder{
+		bucketName: bucketName,
+		expires:    DefaultPresignExpires,
+		metadata:   map[string]string{},
+	}
+}
+
+func (b *PostPolicyBuilder) fail(err error) *PostPolicyBuilder {
+	if b.err == nil {
+		b.err = err
+	}
+	return b
+}
+
+func (b *PostPolicyBuilder) SetExpires(expires time.Duration) *PostPolicyBuilder {
+	if expires < time.Second || expires > MaxPresignExpires {
+		return b.fail(ErrInvalidPresignExpires)
+	}
+	b.expires = expires
+	return b
+}
+
+func (b *PostPolicyBuilder) SetKey(objectKey string) *PostPolicyBuilder {
+	if objectKey == "" {
+		return b.fail(errors.New("post policy key is empty"))
+	}
+	b.key, b.keyPrefix = objectKey, ""
+	return b
+}
+
+// SetKeyStartsWith lets the form choose any key under prefix. The key field
+// defaults to prefix + "${filename}", which S3 replaces with the uploaded
+// file name.
+func (b *PostPolicyBuilder) SetKeyStartsWith(prefix string) *PostPolicyBuilder {
+	b.key, b.keyPrefix = "", prefix
+	return b
+}
+
+func (b *PostPolicyBuilder) SetContentLengthRange(min, max int64) *PostPolicyBuilder {
+	if min < 0 || max < min {
+		return b.fail(fmt.Errorf("invalid content length range %d-%d", min, max))
+	}
+	b.minContentLength, b.maxContentLength, b.hasContentLength = min, max, true
+	return b
+}
+
+func (b *PostPolicyBuilder) SetContentType(contentType string) *PostPolicyBuilder {
+	b.contentType, b.contentTypePrefix = contentType, ""
+	return b
+}
+
+func (b *PostPolicyBuilder) SetContentTypeStartsWith(prefix string) *PostPolicyBuilder {
+	b.contentType, b.contentTypePrefix = "", prefix
+	return b
+}
+
+func (b *PostPolicyBuilder) SetSuccessActionStatus(status int) *PostPolicyBuilder {
+	if status != 200 && status != 201 && status != 204 {
+		return b.fail(fmt.Errorf("success_action_status must be 200, 201 or 204, got %d", status))
+	}
+	b.successActionStatus = status
+	return b
+}
+
+func (b *PostPolicyBuilder) SetMetadata(name, value string) *PostPolicyBuilder {
+	b.metadata["x-amz-meta-"+strings.ToLower(name)] = value
+	return b
+}
+
+// Sign produces the form fields for the policy. It does not call AWS, so it
+// can be used with any credentials and a fixed clock.
+func (b *PostPolicyBuilder) Sign(credentials aws.Credentials, region string, now time.Time) (*PresignedPost, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if b.bucketName == "" {
+		return nil, errors.New("post policy bucket is empty")
+	}
+	if b.key == "" && b.keyPrefix == "" {
+		log.Printf("Post policy for bucket %v allows any key.\n", b.bucketName)
+	}
+	now = now.UTC()
+	expires := now.Add(b.expires)
+	date := now.Format("20060102")
+	amzDate := now.Format("20060102T150405Z")
+	credential := strings.Join([]string{credentials.AccessKeyID, date, region, "s3", "aws4_request"}, "/")
+
+	fields := map[string]string{
+		"x-amz-algorithm":  postPolicyAlgorithm,
+		"x-amz-credential": credential,
+		"x-amz-date":       amzDate,
+	}
+	conditions := []interface{}{
+		map[string]string{"bucket": b.bucketName},
+	}
+	if b.key != "" {
+		fields["key"] = b.key
+		conditions = append(conditions, map[string]string{"key": b.key})
+	} else {
+		fields["key"] = b.keyPrefix + "${filename}"
+		conditions = append(conditions, []string{"starts-with", "$key", b.keyPrefix})
+	}
+	if b.hasContentLength {
+		conditions = append(conditions, []interface{}{"content-length-range", b.minContentLength, b.maxContentLength})
+	}
+	if b.contentType != "" {
+		fields["Content-Type"] = b.contentType
+		conditions = append(conditions, map[string]string{"Content-Type": b.contentType})
+	} else if b.contentTypePrefix != "" {
+		conditions = append(conditions, []string{"starts-with", "$Content-Type", b.contentTypePrefix})
+	}
+	if b.successActionStatus != 0 {
+		status := strconv.Itoa(b.successActionStatus)
+		fields["success_action_status"] = status
+		conditions = append(conditions, map[string]string{"success_action_status": status})
+	}
+	// Sorted so the same policy always signs to the same output.
+	names := make([]string, 0, len(b.metadata))
+	for name := range b.metadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fields[name] = b.metadata[name]
+		conditions = append(conditions, map[string]string{name: b.metadata[name]})
+	}
+	if credentials.SessionToken != "" {
+		fields["x-amz-security-token"] = credentials.SessionToken
+		conditions = append(conditions, map[string]string{"x-amz-security-token": credentials.SessionToken})
+	}
+	conditions = append(conditions,
+		map[string]string{"x-amz-algorithm": postPolicyAlgorithm},
+		map[string]string{"x-amz-credential": credential},
+		map[string]string{"x-amz-date": amzDate},
+	)
+
+	document, err := json.Marshal(map[string]interface{}{
+		"expiration": expires.Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	policy := base64.StdEncoding.EncodeToString(document)
+	fields["policy"] = policy
+
+	signingKey := hmacSHA256([]byte("AWS4"+credentials.SecretAccessKey), date)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	fields["x-amz-signature"] = hex.EncodeToString(hmacSHA256(signingKey, policy))
+
+	return &PresignedPost{
+		URL:     fmt.Sprintf("https://%s.s3.%s.amazonaws.com/", b.bucketName, region),
+		Fields:  fields,
+		Expires: expires,
+	}, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func (s *S3Base) PresignPostObject(policy *PostPolicyBuilder) (*PresignedPost, error) {
+	if s.sdkConfig.Credentials == nil {
+		return nil, errors.New("no credentials configured for post policy signing")
+	}
+	credentials, err := s.sdkConfig.Credentials.Retrieve(context.TODO())
+	if err != nil {
+		log.Printf("Couldn't retrieve credentials to sign post policy. Here's why: %v\n", err)
+		return nil, err
+	}
+	post, err := policy.Sign(credentials, s.sdkConfig.Region, time.Now())
+	if err != nil {
+		log.Printf("Couldn't sign post policy for bucket %v. Here's why: %v\n", policy.bucketName, err)
+	}
+	return post, err
+}
@@ -0,0 +1,194 @@
+package s3action
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	DefaultPresignExpires = 5 * time.Minute
+	MaxPresignExpires     = 7 * 24 * time.Hour
+)
+
+var ErrInvalidPresignExpires = errors.New("presign expiry must be between 1 second and 7 days")
+
+// PresignOptions applies to presigned GET, HEAD and DELETE requests.
+// SSECustomerKey is needed to read SSE-C objects; the client must send the
+// signed SSE-C headers along with the request.
+type PresignOptions struct {
+	Expires        time.Duration
+	VersionId      string
+	SSECustomerKey []byte
+}
+
+// PresignPutOptions constrains what a presigned upload may send. Every
+// non-empty field becomes a signed header, so the client must send exactly
+// the same value or S3 rejects the request.
+type PresignPutOptions struct {
+	Expires        time.Duration
+	ContentType    string
+	ContentLength  int64
+	ContentMD5     string
+	ChecksumSHA256 string
+	Encryption     *Encryption
+	SSECustomerKey []byte
+}
+
+// encryption returns the encryption to sign. SSECustomerKey is kept as a
+// shorthand for SSE-C and is used when Encryption is not set.
+func (o PresignPutOptions) encryption() *Encryption {
+	if o.Encryption == nil && len(o.SSECustomerKey) > 0 {
+		return SSEC(o.SSECustomerKey)
+	}
+	return o.Encryption
+}
+
+type PresignedRequest struct {
+	URL          string
+	Method       string
+	SignedHeader http.Header
+}
+
+func presignExpires(expires time.Duration) (func(*s3.PresignOptions), error) {
+	if expires == 0 {
+		expires = DefaultPresignExpires
+	}
+	if expires < time.Second || expires > MaxPresignExpires {
+		return nil, ErrInvalidPresignExpires
+	}
+	return func(po *s3.PresignOptions) {
+		po.Expires = expires
+	}, nil
+}
+
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return aws.String(value)
+}
+
+func newPresignedRequest(req *v4.PresignedHTTPRequest) *PresignedRequest {
+	return &PresignedRequest{URL: req.URL, Method: req.Method, SignedHeader: req.SignedHeader}
+}
+
+func (s *S3Base) PresignGetObject(bucketName, objectKey string, opts PresignOptions) (*PresignedRequest, error) {
+	expires, err := presignExpires(opts.Expires)
+	if err != nil {
+		return nil, err
+	}
+	input := &s3.GetObjectInput{
+		Bucket:    aws.String(bucketName),
+		Key:       aws.String(objectKey),
+		VersionId: optionalString(opts.VersionId),
+	}
+	(&GetOptions{SSECustomerKey: opts.SSECustomerKey}).applyGet(input)
+	req, err := s3.NewPresignClient(s.S3Client).PresignGetObject(context.TODO(), input, expires)
+	if err != nil {
+		log.Printf("Couldn't presign GET for %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+		return nil, err
+	}
+	return newPresignedRequest(req), nil
+}
+
+func (s *S3Base) PresignPutObject(bucketName, objectKey string, opts PresignPutOptions) (*PresignedRequest, error) {
+	expires, err := presignExpires(opts.Expires)
+	if err != nil {
+		return nil, err
+	}
+	encryption := opts.encryption()
+	if err := encryption.Validate(); err != nil {
+		return nil, err
+	}
+	input := &s3.PutObjectInput{
+		Bucket:         aws.String(bucketName),
+		Key:            aws.String(objectKey),
+		ContentType:    optionalString(opts.ContentType),
+		ContentLength:  opts.ContentLength,
+		ContentMD5:     optionalString(opts.ContentMD5),
+		ChecksumSHA256: optionalString(opts.ChecksumSHA256),
+	}
+	encryption.applyPut(input)
+	req, err := s3.NewPresignClient(s.S3Client).PresignPutObject(context.TODO(), input, expires)
+	if err != nil {
+		log.Printf("Couldn't presign PUT for %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+		return nil, err
+	}
+	return newPresignedRequest(req), nil
+}
+
+func (s *S3Base) PresignDeleteObject(bucketName, objectKey string, opts PresignOptions) (*PresignedRequest, error) {
+	expires, err := presignExpires(opts.Expires)
+	if err != nil {
+		return nil, err
+	}
+	req, err := s3.NewPresignClient(s.S3Client).PresignDeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket:    aws.String(bucketName),
+		Key:       aws.String(objectKey),
+		VersionId: optionalString(opts.VersionId),
+	}, expires)
+	if err != nil {
+		log.Printf("Couldn't presign DELETE for %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+		return nil, err
+	}
+	return newPresignedRequest(req), nil
+}
+
+func (s *S3Base) PresignHeadObject(bucketName, objectKey string, opts PresignOptions) (*PresignedRequest, error) {
+	expires, err := presignExpires(opts.Expires)
+	if err != nil {
+		return nil, err
+	}
+	input := &s3.HeadObjectInput{
+		Bucket:    aws.String(bucketName),
+		Key:       aws.String(objectKey),
+		VersionId: optionalString(opts.VersionId),
+	}
+	(&GetOptions{SSECustomerKey: opts.SSECustomerKey}).applyHead(input)
+	req, err := s3.NewPresignClient(s.S3Client).PresignHeadObject(context.TODO(), input, expires)
+	if err != nil {
+		log.Printf("Couldn't presign HEAD for %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+		return nil, err
+	}
+	return newPresignedRequest(req), nil
+}
+
+// PresignUploadPart presigns one part of a multipart upload. Parts have no
+// content type of their own; set it when the upload is created instead.
+// Only an SSE-C key applies to a part, other encryption is set on the upload.
+func (s *S3Base) PresignUploadPart(bucketName, objectKey, uploadId string, partNumber int32, opts PresignPutOptions) (*PresignedRequest, error) {
+	if opts.ContentType != "" {
+		return nil, errors.New("content type can't be set on an upload part, set it on CreateMultipartUpload")
+	}
+	encryption := opts.encryption()
+	if err := encryption.Validate(); err != nil {
+		return nil, err
+	}
+	expires, err := presignExpires(opts.Expires)
+	if err != nil {
+		return nil, err
+	}
+	input := &s3.UploadPartInput{
+		Bucket:         aws.String(bucketName),
+		Key:            aws.String(objectKey),
+		UploadId:       aws.String(uploadId),
+		PartNumber:     partNumber,
+		ContentLength:  opts.ContentLength,
+		ContentMD5:     optionalString(opts.ContentMD5),
+		ChecksumSHA256: optionalString(opts.ChecksumSHA256),
+	}
+	encryption.applyUploadPart(input)
+	req, err := s3.NewPresignClient(s.S3Client).PresignUploadPart(context.TODO(), input, expires)
+	if err != nil {
+		log.Printf("Couldn't presign UploadPart %d for %v:%v. Here's why: %v\n", partNumber, bucketName, objectKey, err)
+		return nil, err
+	}
+	return newPresignedRequest(req), nil
+}
@@ -0,0 +1,219 @@
+package s3action
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const maxDeleteObjects = 1000
+
+var ErrNoRetentionRule = errors.New("prune needs KeepVersions or KeepNewerThan")
+
+// PruneOptions are the retention rules for noncurrent versions. A version
+// is kept if it is among the KeepVersions newest entries of its key, or if
+// it is younger than KeepNewerThan. Current versions are never pruned.
+type PruneOptions struct {
+	KeepVersions                int
+	KeepNewerThan               time.Duration
+	RemoveOrphanedDeleteMarkers bool
+	DryRun                      bool
+	BatchSize                   int
+	MaxParallel                 int
+}
+
+type PruneReport struct {
+	Bucket               string
+	Prefix               string
+	DryRun               bool
+	Deleted              []ObjectVersion
+	Failed               []ObjectVersion
+	VersionsDeleted      int
+	DeleteMarkersRemoved int
+	BytesReclaimed       int64
+}
+
+// PlanPrune returns the entries of versions, ordered as ListObjectVersions
+// returns them, that the retention rules in opts allow to delete.
+func PlanPrune(versions []ObjectVersion, opts PruneOptions, now time.Time) ([]ObjectVersion, error) {
+	if opts.KeepVersions <= 0 && opts.KeepNewerThan <= 0 {
+		return nil, ErrNoRetentionRule
+	}
+	var prune []ObjectVersion
+	for start := 0; start < len(versions); {
+		end := start
+		for end < len(versions) && versions[end].Key == versions[start].Key {
+			end++
+		}
+		prune = append(prune, planKeyPrune(versions[start:end], opts, now)...)
+		start = end
+	}
+	return prune, nil
+}
+
+func planKeyPrune(history []ObjectVersion, opts PruneOptions, now time.Time) []ObjectVersion {
+	var prune []ObjectVersion
+	var latest *ObjectVersion
+	kept := 0
+	for i, v := range history {
+		keep := v.IsLatest ||
+			(opts.KeepVersions > 0 && i < opts.KeepVersions) ||
+			(opts.KeepNewerThan > 0 && now.Sub(v.LastModified) < opts.KeepNewerThan)
+		switch {
+		case v.IsLatest:
+			latest = &history[i]
+		case keep:
+			kept++
+		default:
+			prune = append(prune, v)
+		}
+	}
+	// A delete marker with nothing left behind it hides nothing.
+	if opts.RemoveOrphanedDeleteMarkers && latest != nil && latest.IsDeleteMarker && kept == 0 {
+		prune = append(prune, *latest)
+	}
+	return prune
+}
+
+// PruneVersions deletes the noncurrent versions under prefix that fall
+// outside the retention rules, in DeleteObjects batches of up to 1000 keys.
+// Orphaned delete markers are removed in a second pass, and only for keys
+// whose older versions were all deleted; otherwise removing the marker
+// would bring a version back. Markers left in place are reported as failed.
+func (s *S3Base) PruneVersions(ctx context.Context, bucketName, prefix string, opts PruneOptions) (*PruneReport, error) {
+	versions, err := s.ListObjectVersions(bucketName, prefix)
+	if err != nil {
+		return nil, err
+	}
+	prune, err := PlanPrune(versions, opts, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	report := &PruneReport{Bucket: bucketName, Prefix: prefix, DryRun: opts.DryRun}
+	if opts.DryRun {
+		report.add(prune)
+		return report, nil
+	}
+
+	var noncurrent, markers []ObjectVersion
+	for _, v := range prune {
+		if v.IsLatest {
+			markers = append(markers, v)
+		} else {
+			noncurrent = append(noncurrent, v)
+		}
+	}
+	err = s.pruneBatches(ctx, bucketName, noncurrent, opts, report)
+
+	if len(markers) > 0 {
+		deleted := make(map[string]bool, len(report.Deleted))
+		for _, v := range report.Deleted {
+			deleted[v.Key+"\x00"+v.VersionId] = true
+		}
+		pending := map[string]bool{}
+		for _, v := range noncurrent {
+			if !deleted[v.Key+"\x00"+v.VersionId] {
+				pending[v.Key] = true
+			}
+		}
+		var orphans []ObjectVersion
+		for _, m := range markers {
+			if pending[m.Key] || ctx.Err() != nil {
+				report.Failed = append(report.Failed, m)
+			} else {
+				orphans = append(orphans, m)
+			}
+		}
+		if markerErr := s.pruneBatches(ctx, bucketName, orphans, opts, report); err == nil {
+			err = markerErr
+		}
+	}
+	log.Printf("Pruned %v/%v: %d versions and %d delete markers removed, %d bytes reclaimed, %d failed\n",
+		bucketName, prefix, report.VersionsDeleted, report.DeleteMarkersRemoved, report.BytesReclaimed, len(report.Failed))
+	return report, err
+}
+
+func (s *S3Base) pruneBatches(ctx context.Context, bucketName string, prune []ObjectVersion, opts PruneOptions, report *PruneReport) error {
+	if len(prune) == 0 {
+		return nil
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 || batchSize > maxDeleteObjects {
+		batchSize = maxDeleteObjects
+	}
+	var batches [][]ObjectVersion
+	for start := 0; start < len(prune); start += batchSize {
+		end := start + batchSize
+		if end > len(prune) {
+			end = len(prune)
+		}
+		batches = append(batches, prune[start:end])
+	}
+
+	var mu sync.Mutex
+	_, stats, err := RunBatch(ctx, batches, BatchOptions{MaxParallel: opts.MaxParallel}, func(ctx context.Context, batch []ObjectVersion) error {
+		deleted, failed, err := s.deleteVersions(ctx, bucketName, batch)
+		mu.Lock()
+		defer mu.Unlock()
+		report.add(deleted)
+		report.Failed = append(report.Failed, failed...)
+		return err
+	})
+	logBatchStats("prune", bucketName, stats)
+	return err
+}
+
+func (r *PruneReport) add(deleted []ObjectVersion) {
+	for _, v := range deleted {
+		if v.IsDeleteMarker {
+			r.DeleteMarkersRemoved++
+		} else {
+			r.VersionsDeleted++
+			r.BytesReclaimed += v.Size
+		}
+	}
+	r.Deleted = append(r.Deleted, deleted...)
+}
+
+func (s *S3Base) deleteVersions(ctx context.Context, bucketName string, versions []ObjectVersion) ([]ObjectVersion, []ObjectVersion, error) {
+	objectIds := make([]types.ObjectIdentifier, len(versions))
+	for i, v := range versions {
+		objectIds[i] = types.ObjectIdentifier{Key: aws.String(v.Key), VersionId: aws.String(v.VersionId)}
+	}
+	output, err := s.S3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(bucketName),
+		Delete: &types.Delete{Objects: objectIds, Quiet: true},
+	})
+	if err != nil {
+		log.Printf("Couldn't delete object versions from bucket %v. Here's why: %v\n", bucketName, err)
+		return nil, versions, err
+	}
+	if len(output.Errors) == 0 {
+		return versions, nil, nil
+	}
+
+	failedIds := make(map[string]bool, len(output.Errors))
+	for _, e := range output.Errors {
+		failedIds[aws.ToString(e.Key)+"\x00"+aws.ToString(e.VersionId)] = true
+	}
+	var deleted, failed []ObjectVersion
+	for _, v := range versions {
+		if failedIds[v.Key+"\x00"+v.VersionId] {
+			failed = append(failed, v)
+		} else {
+			deleted = append(deleted, v)
+		}
+	}
+	first := output.Errors[0]
+	err = fmt.Errorf("couldn't delete %d versions, first %v (%v): %v",
+		len(output.Errors), aws.ToString(first.Key), aws.ToString(first.Code), aws.ToString(first.Message))
+	log.Printf("Couldn't delete object versions from bucket %v. Here's why: %v\n", bucketName, err)
+	return deleted, failed, err
+}
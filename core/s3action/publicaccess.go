@@ -0,0 +1,226 @@
+package s3action
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+var ErrPublicAclBlocked = errors.New("public ACLs are blocked on this bucket")
+
+func apiErrorCode(err error) string {
+	var apiError smithy.APIError
+	if errors.As(err, &apiError) {
+		return apiError.ErrorCode()
+	}
+	return ""
+}
+
+type PublicAccessBlock struct {
+	BlockPublicAcls       bool
+	IgnorePublicAcls      bool
+	BlockPublicPolicy     bool
+	RestrictPublicBuckets bool
+}
+
+func BlockAllPublicAccess() PublicAccessBlock {
+	return PublicAccessBlock{true, true, true, true}
+}
+
+// GetPublicAccessBlock returns the bucket's settings. A bucket without a
+// configuration blocks nothing, so all fields are false.
+func (s *S3Base) GetPublicAccessBlock(bucketName string) (PublicAccessBlock, error) {
+	output, err := s.S3Client.GetPublicAccessBlock(context.TODO(), &s3.GetPublicAccessBlockInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		if apiErrorCode(err) == "NoSuchPublicAccessBlockConfiguration" {
+			return PublicAccessBlock{}, nil
+		}
+		log.Printf("Couldn't get public access block of bucket %v. Here's why: %v\n", bucketName, err)
+		return PublicAccessBlock{}, err
+	}
+	config := output.PublicAccessBlockConfiguration
+	if config == nil {
+		return PublicAccessBlock{}, nil
+	}
+	return PublicAccessBlock{
+		BlockPublicAcls:       config.BlockPublicAcls,
+		IgnorePublicAcls:      config.IgnorePublicAcls,
+		BlockPublicPolicy:     config.BlockPublicPolicy,
+		RestrictPublicBuckets: config.RestrictPublicBuckets,
+	}, nil
+}
+
+func (s *S3Base) PutPublicAccessBlock(bucketName string, block PublicAccessBlock) error {
+	_, err := s.S3Client.PutPublicAccessBlock(context.TODO(), &s3.PutPublicAccessBlockInput{
+		Bucket: aws.String(bucketName),
+		PublicAccessBlockConfiguration: &types.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       block.BlockPublicAcls,
+			IgnorePublicAcls:      block.IgnorePublicAcls,
+			BlockPublicPolicy:     block.BlockPublicPolicy,
+			RestrictPublicBuckets: block.RestrictPublicBuckets,
+		},
+	})
+	if err != nil {
+		log.Printf("Couldn't put public access block on bucket %v. Here's why: %v\n", bucketName, err)
+	}
+	return err
+}
+
+func (s *S3Base) DeletePublicAccessBlock(bucketName string) error {
+	_, err := s.S3Client.DeletePublicAccessBlock(context.TODO(), &s3.DeletePublicAccessBlockInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		log.Printf("Couldn't delete public access block of bucket %v. Here's why: %v\n", bucketName, err)
+	}
+	return err
+}
+
+// GetObjectOwnership returns the bucket's ownership setting. Buckets without
+// ownership controls behave as ObjectWriter.
+func (s *S3Base) GetObjectOwnership(bucketName string) (types.ObjectOwnership, error) {
+	output, err := s.S3Client.GetBucketOwnershipControls(context.TODO(), &s3.GetBucketOwnershipControlsInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		if apiErrorCode(err) == "OwnershipControlsNotFoundError" {
+			return types.ObjectOwnershipObjectWriter, nil
+		}
+		log.Printf("Couldn't get ownership controls of bucket %v. Here's why: %v\n", bucketName, err)
+		return "", err
+	}
+	if output.OwnershipControls == nil || len(output.OwnershipControls.Rules) == 0 {
+		return types.ObjectOwnershipObjectWriter, nil
+	}
+	return output.OwnershipControls.Rules[0].ObjectOwnership, nil
+}
+
+func (s *S3Base) PutObjectOwnership(bucketName string, ownership types.ObjectOwnership) error {
+	_, err := s.S3Client.PutBucketOwnershipControls(context.TODO(), &s3.PutBucketOwnershipControlsInput{
+		Bucket: aws.String(bucketName),
+		OwnershipControls: &types.OwnershipControls{
+			Rules: []types.OwnershipControlsRule{{ObjectOwnership: ownership}},
+		},
+	})
+	if err != nil {
+		log.Printf("Couldn't put ownership controls on bucket %v. Here's why: %v\n", bucketName, err)
+	}
+	return err
+}
+
+func (s *S3Base) DeleteOwnershipControls(bucketName string) error {
+	_, err := s.S3Client.DeleteBucketOwnershipControls(context.TODO(), &s3.DeleteBucketOwnershipControlsInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		log.Printf("Couldn't delete ownership controls of bucket %v. Here's why: %v\n", bucketName, err)
+	}
+	return err
+}
+
+type PublicAclReport struct {
+	Bucket            string
+	Ownership         types.ObjectOwnership
+	PublicAccessBlock PublicAccessBlock
+	Problems          []string
+}
+
+func (r *PublicAclReport) Allowed() bool {
+	return len(r.Problems) == 0
+}
+
+// CheckPublicAcl reports the bucket settings that would reject or neutralise
+// a public ACL, matching the object ownership and block public access
+// steps in the README. Only the bucket-level block is checked: an
+// account-level block, set through S3 Control, overrides it, so a bucket
+// reported as allowed can still have its public ACLs blocked or ignored.
+func (s *S3Base) CheckPublicAcl(bucketName string) (*PublicAclReport, error) {
+	ownership, err := s.GetObjectOwnership(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	block, err := s.GetPublicAccessBlock(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	report := &PublicAclReport{Bucket: bucketName, Ownership: ownership, PublicAccessBlock: block}
+	if ownership == types.ObjectOwnershipBucketOwnerEnforced {
+		report.Problems = append(report.Problems, "object ownership is BucketOwnerEnforced, so ACLs are disabled")
+	}
+	if block.BlockPublicAcls {
+		report.Problems = append(report.Problems, "BlockPublicAcls rejects requests that set public ACLs")
+	}
+	if block.IgnorePublicAcls {
+		report.Problems = append(report.Problems, "IgnorePublicAcls makes public ACLs have no effect")
+	}
+	return report, nil
+}
+
+type PublicAclOptions struct {
+	AdjustSettings bool
+	PutOptions     []PutOption
+}
+
+type PublicAclOption func(*PublicAclOptions)
+
+// WithAdjustPublicAccess lets the public helpers enable ACLs and relax the
+// ACL part of block public access instead of failing.
+func WithAdjustPublicAccess() PublicAclOption {
+	return func(o *PublicAclOptions) {
+		o.AdjustSettings = true
+	}
+}
+
+// WithPublicUploadOptions passes headers, encryption and the other put
+// options through to UploadPublicFileAcl.
+func WithPublicUploadOptions(opts ...PutOption) PublicAclOption {
+	return func(o *PublicAclOptions) {
+		o.PutOptions = append(o.PutOptions, opts...)
+	}
+}
+
+func newPublicAclOptions(opts []PublicAclOption) *PublicAclOptions {
+	publicAclOptions := &PublicAclOptions{}
+	for _, opt := range opts {
+		opt(publicAclOptions)
+	}
+	return publicAclOptions
+}
+
+func (s *S3Base) preparePublicAcl(bucketName string, opts []PublicAclOption) error {
+	publicAclOptions := newPublicAclOptions(opts)
+	report, err := s.CheckPublicAcl(bucketName)
+	if err != nil {
+		return err
+	}
+	if report.Allowed() {
+		return nil
+	}
+	if !publicAclOptions.AdjustSettings {
+		err = fmt.Errorf("%w: bucket %v: %v", ErrPublicAclBlocked, bucketName, strings.Join(report.Problems, "; "))
+		log.Printf("Couldn't apply public ACL. Here's why: %v\n", err)
+		return err
+	}
+
+	log.Printf("Adjusting bucket %v to allow public ACLs: %v\n", bucketName, strings.Join(report.Problems, "; "))
+	if report.Ownership == types.ObjectOwnershipBucketOwnerEnforced {
+		if err := s.PutObjectOwnership(bucketName, types.ObjectOwnershipBucketOwnerPreferred); err != nil {
+			return err
+		}
+	}
+	if report.PublicAccessBlock.BlockPublicAcls || report.PublicAccessBlock.IgnorePublicAcls {
+		block := report.PublicAccessBlock
+		block.BlockPublicAcls, block.IgnorePublicAcls = false, false
+		return s.PutPublicAccessBlock(bucketName, block)
+	}
+	return nil
+}
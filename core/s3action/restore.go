@@ -0,0 +1,156 @@
+package s3action
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type RestoreAction string
+
+const (
+	RestoreActionUnchanged RestoreAction = "unchanged"
+	RestoreActionRestore   RestoreAction = "restore"
+	RestoreActionDelete    RestoreAction = "delete"
+)
+
+// RestoreEntry is the plan for one key. VersionId is the version that was
+// current at the point in time, empty when the key didn't exist or was
+// deleted then.
+type RestoreEntry struct {
+	Key              string
+	Action           RestoreAction
+	VersionId        string
+	CurrentVersionId string
+	Err              error
+}
+
+type RestoreReport struct {
+	Bucket      string
+	Prefix      string
+	PointInTime time.Time
+	DryRun      bool
+	Entries     []RestoreEntry
+	Restored    int
+	Deleted     int
+	Unchanged   int
+	Failed      int
+}
+
+func (r *RestoreReport) count() {
+	r.Restored, r.Deleted, r.Unchanged, r.Failed = 0, 0, 0, 0
+	for _, e := range r.Entries {
+		switch {
+		case e.Err != nil:
+			r.Failed++
+		case e.Action == RestoreActionRestore:
+			r.Restored++
+		case e.Action == RestoreActionDelete:
+			r.Deleted++
+		default:
+			r.Unchanged++
+		}
+	}
+}
+
+type PointInTimeOptions struct {
+	DryRun      bool
+	MaxParallel int
+	CopyOptions []CopyOption
+}
+
+// PlanPointInTimeRestore works out, for every key in versions, what has to
+// change so that the key looks as it did at pointInTime. versions must be
+// ordered as ListObjectVersions returns them.
+func PlanPointInTimeRestore(versions []ObjectVersion, pointInTime time.Time) []RestoreEntry {
+	var entries []RestoreEntry
+	for start := 0; start < len(versions); {
+		end := start
+		for end < len(versions) && versions[end].Key == versions[start].Key {
+			end++
+		}
+		entries = append(entries, planKeyRestore(versions[start:end], pointInTime))
+		start = end
+	}
+	return entries
+}
+
+func planKeyRestore(history []ObjectVersion, pointInTime time.Time) RestoreEntry {
+	current := history[0]
+	for _, v := range history {
+		if v.IsLatest {
+			current = v
+			break
+		}
+	}
+	entry := RestoreEntry{Key: current.Key, Action: RestoreActionUnchanged}
+	if !current.IsDeleteMarker {
+		entry.CurrentVersionId = current.VersionId
+	}
+
+	var target *ObjectVersion
+	for i := range history {
+		if !history[i].LastModified.After(pointInTime) {
+			target = &history[i]
+			break
+		}
+	}
+	switch {
+	case target == nil || target.IsDeleteMarker:
+		if !current.IsDeleteMarker {
+			entry.Action = RestoreActionDelete
+		}
+	case target.VersionId != current.VersionId:
+		entry.Action, entry.VersionId = RestoreActionRestore, target.VersionId
+	default:
+		entry.VersionId = target.VersionId
+	}
+	return entry
+}
+
+// RestorePrefixToPointInTime brings every key under prefix back to the
+// state it had at pointInTime: older versions are copied back to be current
+// and keys created afterwards get a delete marker. Nothing is removed from
+// the version history, so a restore can itself be rolled back. With DryRun
+// the report only contains the plan.
+func (s *S3Base) RestorePrefixToPointInTime(ctx context.Context, bucketName, prefix string, pointInTime time.Time, opts PointInTimeOptions) (*RestoreReport, error) {
+	versions, err := s.ListObjectVersions(bucketName, prefix)
+	if err != nil {
+		return nil, err
+	}
+	report := &RestoreReport{
+		Bucket:      bucketName,
+		Prefix:      prefix,
+		PointInTime: pointInTime,
+		DryRun:      opts.DryRun,
+		Entries:     PlanPointInTimeRestore(versions, pointInTime),
+	}
+	if opts.DryRun {
+		report.count()
+		return report, nil
+	}
+
+	var pending []int
+	for i, e := range report.Entries {
+		if e.Action != RestoreActionUnchanged {
+			pending = append(pending, i)
+		}
+	}
+	results, stats, err := RunBatch(ctx, pending, BatchOptions{MaxParallel: opts.MaxParallel}, func(ctx context.Context, i int) error {
+		e := report.Entries[i]
+		if e.Action == RestoreActionDelete {
+			return s.deleteObject(ctx, bucketName, types.Object{Key: &e.Key})
+		}
+		return s.restoreVersion(ctx, bucketName, e.Key, e.VersionId, opts.CopyOptions...)
+	})
+	for _, r := range results {
+		report.Entries[r.Item].Err = r.Err
+	}
+	report.count()
+	logBatchStats("point-in-time restore", bucketName, stats)
+	log.Printf("Restored %v/%v to %v: %d restored, %d deleted, %d unchanged, %d failed\n",
+		bucketName, prefix, pointInTime, report.Restored, report.Deleted, report.Unchanged, report.Failed)
+	return report, err
+}
@@ -0,0 +1,366 @@
+package s3action
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// RetryPolicy controls how many times an S3 call is attempted and how long
+// to wait between attempts. Delays grow exponentially from BaseDelay and are
+// capped at MaxBackoff, with full jitter applied.
+type RetryPolicy struct {
+	MaxAttempts          int
+	BaseDelay            time.Duration
+	MaxBackoff           time.Duration
+	RetryableCodes       []string
+	RetryableStatusCodes []int
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:          5,
+		BaseDelay:            100 * time.Millisecond,
+		MaxBackoff:           20 * time.Second,
+		RetryableCodes:       []string{"SlowDown", "RequestTimeout", "InternalError", "ServiceUnavailable"},
+		RetryableStatusCodes: []int{500, 502, 503, 504},
+	}
+}
+
+func (p RetryPolicy) NewRetryer() aws.Retryer {
+	return retry.NewStandard(func(o *retry.StandardOptions) {
+		if p.MaxAttempts > 0 {
+			o.MaxAttempts = p.MaxAttempts
+		}
+		if p.MaxBackoff > 0 {
+			o.MaxBackoff = p.MaxBackoff
+		}
+		o.Backoff = jitterBackoff{base: p.BaseDelay, max: o.MaxBackoff}
+
+		if len(p.RetryableCodes) > 0 {
+			codes := make(map[string]struct{}, len(p.RetryableCodes))
+			for _, code := range p.RetryableCodes {
+				codes[code] = struct{}{}
+			}
+			o.Retryables = append(o.Retryables, retry.RetryableErrorCode{Codes: codes})
+		}
+		if len(p.RetryableStatusCodes) > 0 {
+			statusCodes := make(map[int]struct{}, len(p.RetryableStatusCodes))
+			for _, code := range p.RetryableStatusCodes {
+				statusCodes[code] = struct{}{}
+			}
+			o.Retryables = append(o.Retryables, retry.RetryableHTTPStatusCode{Codes: statusCodes})
+		}
+	})
+}
+
+type jitterBackoff struct {
+	base time.Duration
+	max  time.Duration
+}
+
+func (b jitterBackoff) BackoffDelay(attempt int, err error) (time.Duration, error) {
+	base := b.base
+	if base <= 0 {
+		base = 100 * time.Millisecond
+	}
+	delay := b.max
+	if attempt < 32 {
+		if d := base << uint(attempt-1); d > 0 && d < b.max {
+			delay = d
+		}
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1)), nil
+}
+
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	return DefaultRetryPolicy().NewRetryer().IsErrorRetryable(err)
+}
+
+// OperationStats holds retry counters for one S3 operation, e.g. "PutObject".
+type OperationStats struct {
+	Calls     int64
+	Attempts  int64
+	Retries   int64
+	Throttles int64
+	Failures  int64
+}
+
+type RetryMetrics struct {
+	mu  sync.Mutex
+	ops map[string]*OperationStats
+}
+
+func NewRetryMetrics() *RetryMetrics {
+	return &RetryMetrics{ops: map[string]*OperationStats{}}
+}
+
+func (m *RetryMetrics) record(operation string, results []retry.AttemptResult, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats, ok := m.ops[operation]
+	if !ok {
+		stats = &OperationStats{}
+		m.ops[operation] = stats
+	}
+	stats.Calls++
+	stats.Attempts += int64(len(results))
+	if len(results) > 1 {
+		stats.Retries += int64(len(results) - 1)
+	}
+	for _, r := range results {
+		if r.Err != nil && retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(r.Err).Bool() {
+			stats.Throttles++
+		}
+	}
+	if err != nil {
+		stats.Failures++
+	}
+}
+
+func (m *RetryMetrics) Snapshot() map[string]OperationStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot := make(map[string]OperationStats, len(m.ops))
+	for op, stats := range m.ops {
+		snapshot[op] = *stats
+	}
+	return snapshot
+}
+
+// RateLimiter is a client-side token bucket per bucket/prefix. The rate is
+// halved whenever S3 throttles a request and grows back slowly on success.
+// A zero RateLimiter doesn't limit anything.
+type RateLimiter struct {
+	InitialRate float64
+	MinRate     float64
+	MaxRate     float64
+	PrefixDepth int
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(initialRate, minRate, maxRate float64) (*RateLimiter, error) {
+	if initialRate <= 0 || minRate <= 0 || maxRate <= 0 {
+		return nil, fmt.Errorf("rate limits must be positive, got initial %v, min %v, max %v", initialRate, minRate, maxRate)
+	}
+	if minRate > initialRate || initialRate > maxRate {
+		return nil, fmt.Errorf("initial rate %v must be between min %v and max %v", initialRate, minRate, maxRate)
+	}
+	return &RateLimiter{
+		InitialRate: initialRate,
+		MinRate:     minRate,
+		MaxRate:     maxRate,
+		PrefixDepth: 1,
+	}, nil
+}
+
+func (l *RateLimiter) LimitKey(bucketName, objectKey string) string {
+	segments := strings.Split(objectKey, "/")
+	if len(segments) <= l.PrefixDepth {
+		segments = segments[:len(segments)-1]
+	} else {
+		segments = segments[:l.PrefixDepth]
+	}
+	if len(segments) == 0 {
+		return bucketName
+	}
+	return bucketName + "/" + strings.Join(segments, "/")
+}
+
+func (l *RateLimiter) bucket(key string, now time.Time) *tokenBucket {
+	if l.buckets == nil {
+		l.buckets = map[string]*tokenBucket{}
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{rate: l.InitialRate, tokens: 1, last: now}
+		l.buckets[key] = b
+	}
+	return b
+}
+
+func (l *RateLimiter) Wait(ctx context.Context, key string) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		b := l.bucket(key, now)
+		if b.rate <= 0 {
+			l.mu.Unlock()
+			return nil
+		}
+		// The bucket holds at least one token, so rates below 1/s still
+		// let a request through every 1/rate seconds.
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if capacity := math.Max(b.rate, 1); b.tokens > capacity {
+			b.tokens = capacity
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (l *RateLimiter) Feedback(key string, throttled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucket(key, time.Now())
+	if throttled {
+		b.rate /= 2
+		if b.rate < l.MinRate {
+			b.rate = l.MinRate
+		}
+		log.Printf("Throttled on %v, lowering request rate to %.2f/s\n", key, b.rate)
+		return
+	}
+	b.rate += l.MaxRate / 100
+	if b.rate > l.MaxRate {
+		b.rate = l.MaxRate
+	}
+}
+
+func (l *RateLimiter) Rate(key string) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.bucket(key, time.Now()).rate
+}
+
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	retryPolicy     *RetryPolicy
+	operationPolicy map[string]RetryPolicy
+	rateLimiter     *RateLimiter
+}
+
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(o *clientOptions) {
+		o.retryPolicy = &policy
+	}
+}
+
+// WithOperationRetryPolicy overrides the retry policy for a single S3
+// operation, named as in the SDK (e.g. "PutObject", "ListObjectsV2").
+func WithOperationRetryPolicy(operation string, policy RetryPolicy) ClientOption {
+	return func(o *clientOptions) {
+		o.operationPolicy[operation] = policy
+	}
+}
+
+func WithRateLimiter(limiter *RateLimiter) ClientOption {
+	return func(o *clientOptions) {
+		o.rateLimiter = limiter
+	}
+}
+
+type rateLimitKey struct{}
+
+func (o *clientOptions) apply(s3Options *s3.Options, metrics *RetryMetrics) {
+	if o.retryPolicy != nil {
+		s3Options.Retryer = o.retryPolicy.NewRetryer()
+	}
+
+	operationRetryers := make(map[string]aws.Retryer, len(o.operationPolicy))
+	for operation, policy := range o.operationPolicy {
+		operationRetryers[operation] = policy.NewRetryer()
+	}
+
+	s3Options.APIOptions = append(s3Options.APIOptions, func(stack *middleware.Stack) error {
+		operation := stack.ID()
+		if retryer, ok := operationRetryers[operation]; ok {
+			attempt := retry.NewAttemptMiddleware(retryer, smithyhttp.RequestCloner)
+			if _, err := stack.Finalize.Swap("Retry", attempt); err != nil {
+				return err
+			}
+		}
+
+		err := stack.Initialize.Add(middleware.InitializeMiddlewareFunc("S3ActionRetryMetrics",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+				middleware.InitializeOutput, middleware.Metadata, error,
+			) {
+				if o.rateLimiter != nil {
+					bucketName, objectKey := requestTarget(in.Parameters)
+					ctx = middleware.WithStackValue(ctx, rateLimitKey{}, o.rateLimiter.LimitKey(bucketName, objectKey))
+				}
+				out, metadata, err := next.HandleInitialize(ctx, in)
+				results, _ := retry.GetAttemptResults(metadata)
+				metrics.record(operation, results.Results, err)
+				if len(results.Results) > 1 {
+					log.Printf("Operation %v was attempted %d times. Last error: %v\n",
+						operation, len(results.Results), err)
+				}
+				return out, metadata, err
+			}), middleware.After)
+		if err != nil || o.rateLimiter == nil {
+			return err
+		}
+
+		return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("S3ActionRateLimit",
+			func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (
+				middleware.FinalizeOutput, middleware.Metadata, error,
+			) {
+				key, _ := middleware.GetStackValue(ctx, rateLimitKey{}).(string)
+				if err := o.rateLimiter.Wait(ctx, key); err != nil {
+					return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+				}
+				out, metadata, err := next.HandleFinalize(ctx, in)
+				throttled := err != nil && retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err).Bool()
+				o.rateLimiter.Feedback(key, throttled)
+				return out, metadata, err
+			}), "Retry", middleware.After)
+	})
+}
+
+func requestTarget(params interface{}) (string, string) {
+	v := reflect.Indirect(reflect.ValueOf(params))
+	if v.Kind() != reflect.Struct {
+		return "", ""
+	}
+	field := func(name string) string {
+		f := v.FieldByName(name)
+		if f.IsValid() && f.Kind() == reflect.Ptr && !f.IsNil() && f.Elem().Kind() == reflect.String {
+			return f.Elem().String()
+		}
+		return ""
+	}
+	objectKey := field("Key")
+	if objectKey == "" {
+		objectKey = field("Prefix")
+	}
+	return field("Bucket"), objectKey
+}
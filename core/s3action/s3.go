@@ -4,10 +4,11 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"log"
+	"net/url"
 	"os"
-	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -18,16 +19,68 @@ import (
 )
 
 type S3Base struct {
-	S3Client *s3.Client
+	S3Client      *s3.Client
+	RetryMetrics  *RetryMetrics
+	sdkConfig     aws.Config
+	clientOptions func(*s3.Options)
 }
 
-func NewS3Client() *S3Base {
+func NewS3Client(opts ...ClientOption) *S3Base {
 	sdkConfig, err := config.LoadDefaultConfig(context.TODO())
 	if err != nil {
 		log.Fatalf("Couldn't load default configuration. Have you set up your AWS account?, err: %v", err)
 	}
-	s3Client := s3.NewFromConfig(sdkConfig)
-	return &S3Base{S3Client: s3Client}
+	clientOpts := &clientOptions{operationPolicy: map[string]RetryPolicy{}}
+	for _, opt := range opts {
+		opt(clientOpts)
+	}
+	metrics := NewRetryMetrics()
+	optFn := func(o *s3.Options) {
+		clientOpts.apply(o, metrics)
+	}
+	s3Client := s3.NewFromConfig(sdkConfig, optFn)
+	return &S3Base{S3Client: s3Client, RetryMetrics: metrics, sdkConfig: sdkConfig, clientOptions: optFn}
+}
+
+// ForRegion returns a copy of the client that sends requests to region,
+// with the same retry and rate limit settings. Buckets must be called
+// through a client for their own region.
+func (s *S3Base) ForRegion(region string) *S3Base {
+	if region == "" || region == s.sdkConfig.Region {
+		return s
+	}
+	sdkConfig := s.sdkConfig.Copy()
+	sdkConfig.Region = region
+	optFns := []func(*s3.Options){}
+	if s.clientOptions != nil {
+		optFns = append(optFns, s.clientOptions)
+	}
+	return &S3Base{
+		S3Client:      s3.NewFromConfig(sdkConfig, optFns...),
+		RetryMetrics:  s.RetryMetrics,
+		sdkConfig:     sdkConfig,
+		clientOptions: s.clientOptions,
+	}
+}
+
+// GetBucketRegion looks up the region a bucket was created in.
+// GetBucketLocation reports us-east-1 as an empty constraint and old
+// eu-west-1 buckets as "EU".
+func (s *S3Base) GetBucketRegion(bucketName string) (string, error) {
+	output, err := s.S3Client.GetBucketLocation(context.TODO(), &s3.GetBucketLocationInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		log.Printf("Couldn't get location of bucket %v. Here's why: %v\n", bucketName, err)
+		return "", err
+	}
+	switch output.LocationConstraint {
+	case "":
+		return "us-east-1", nil
+	case types.BucketLocationConstraintEu:
+		return "eu-west-1", nil
+	}
+	return string(output.LocationConstraint), nil
 }
 
 func (s *S3Base) GetBucketList() ([]types.Bucket, error) {
@@ -63,9 +116,12 @@ func (s *S3Base) BucketExists(bucketName string) (bool, error) {
 	return exists, err
 }
 
-func (s *S3Base) CreateBucket(name string, region string) error {
+func (s *S3Base) CreateBucket(name string, region string, opts ...BucketOption) error {
+	bucketOptions := newBucketOptions(opts)
 	_, err := s.S3Client.CreateBucket(context.TODO(), &s3.CreateBucketInput{
-		Bucket: aws.String(name),
+		Bucket:                     aws.String(name),
+		ObjectOwnership:            bucketOptions.ObjectOwnership,
+		ObjectLockEnabledForBucket: bucketOptions.ObjectLock,
 		CreateBucketConfiguration: &types.CreateBucketConfiguration{
 			LocationConstraint: types.BucketLocationConstraint(region),
 		},
@@ -74,54 +130,37 @@ func (s *S3Base) CreateBucket(name string, region string) error {
 	if err != nil {
 		log.Printf("Couldn't create bucket %v in Region %v. Here's why: %v\n",
 			name, region, err)
-	}
-	return err
-}
-
-func (s *S3Base) CreatePublicBucket(bucketName, region string) error {
-	input := &s3.CreateBucketInput{
-		Bucket: aws.String(bucketName),
-		ACL:    types.BucketCannedACLPublicReadWrite,
-		CreateBucketConfiguration: &types.CreateBucketConfiguration{
-			LocationConstraint: types.BucketLocationConstraint(region),
-		},
-	}
-	_, err := s.S3Client.CreateBucket(context.TODO(), input)
-	if err != nil {
 		return err
 	}
+	if bucketOptions.Versioning && !bucketOptions.ObjectLock {
+		return s.EnableVersioning(name)
+	}
 	return nil
 }
 
-func (s *S3Base) CreateBucketAndEnabledVersion(bucketName, region string) error {
-	err := s.CreatePublicBucket(bucketName, region)
+// CreatePublicBucket creates a bucket with a public-read-write ACL. New
+// buckets block public ACLs by default, so without WithAdjustPublicAccess the
+// ACL step fails; the bucket is then deleted again rather than left behind
+// half configured.
+func (s *S3Base) CreatePublicBucket(bucketName, region string, opts ...PublicAclOption) error {
+	err := s.CreateBucket(bucketName, region, WithObjectOwnership(types.ObjectOwnershipBucketOwnerPreferred))
 	if err != nil {
 		return err
 	}
-
-	putInput := &s3.PutBucketVersioningInput{
-		Bucket: &bucketName,
-		VersioningConfiguration: &types.VersioningConfiguration{
-			Status: types.BucketVersioningStatusEnabled,
-		},
-	}
-	_, err = s.S3Client.PutBucketVersioning(context.TODO(), putInput)
-	if err != nil {
-		return err
+	if err = s.PutPublicBucketAcl(bucketName, opts...); err != nil {
+		if deleteErr := s.DeleteBucket(bucketName); deleteErr != nil {
+			log.Printf("Couldn't remove bucket %v after public ACL failure: %v\n", bucketName, deleteErr)
+		}
 	}
-	return nil
+	return err
 }
 
-func (s *S3Base) PutPublicBucketAcl(bucketName string) error {
-	putInput := &s3.PutBucketAclInput{
-		Bucket: aws.String(bucketName),
-		ACL:    types.BucketCannedACLPublicReadWrite,
-	}
-	_, err := s.S3Client.PutBucketAcl(context.TODO(), putInput)
-	if err != nil {
-		return err
-	}
-	return nil
+func (s *S3Base) CreateBucketAndEnabledVersion(bucketName, region string) error {
+	return s.CreateBucket(bucketName, region, WithVersioning())
+}
+
+func (s *S3Base) PutPublicBucketAcl(bucketName string, opts ...PublicAclOption) error {
+	return s.PutBucketCannedAcl(bucketName, types.BucketCannedACLPublicReadWrite, opts...)
 }
 
 func (s *S3Base) DeleteBucket(bucketName string) error {
@@ -133,23 +172,40 @@ func (s *S3Base) DeleteBucket(bucketName string) error {
 	return err
 }
 
-func (s *S3Base) UploadFile(bucketName string, objectKey string, fileName string) error {
+func (s *S3Base) UploadFile(bucketName string, objectKey string, fileName string, opts ...PutOption) error {
+	return s.uploadFile(context.TODO(), bucketName, objectKey, fileName, opts...)
+}
+
+func (s *S3Base) uploadFile(ctx context.Context, bucketName string, objectKey string, fileName string, opts ...PutOption) error {
 	file, err := os.Open(fileName)
 	if err != nil {
 		log.Printf("Couldn't open file %v to upload. Here's why: %v\n", fileName, err)
 	} else {
-		defer func(file *os.File) {
-			err := file.Close()
-			if err != nil {
-				log.Fatalf("file close err: %v", err)
-			}
-		}(file)
+		defer file.Close()
 
-		_, err := s.S3Client.PutObject(context.TODO(), &s3.PutObjectInput{
+		putOptions := newPutOptions(opts)
+		if err = putOptions.validate(); err != nil {
+			log.Printf("Couldn't upload file %v. Here's why: %v\n", fileName, err)
+			return err
+		}
+		if err = putOptions.detectReaderContentType(objectKey, file); err != nil {
+			log.Printf("Couldn't read file %v to detect content type. Here's why: %v\n", fileName, err)
+			return err
+		}
+		input := &s3.PutObjectInput{
 			Bucket: aws.String(bucketName),
 			Key:    aws.String(objectKey),
 			Body:   file,
-		})
+		}
+		putOptions.apply(input)
+		if algorithm, ok := putOptions.compression(objectKey); ok {
+			stat, err := file.Stat()
+			if err != nil {
+				return err
+			}
+			return s.uploadCompressed(ctx, input, file, stat.Size(), algorithm)
+		}
+		_, err = s.S3Client.PutObject(ctx, input)
 		if err != nil {
 			log.Printf("Couldn't upload file %v to %v:%v. Here's why: %v\n",
 				fileName, bucketName, objectKey, err)
@@ -158,17 +214,34 @@ func (s *S3Base) UploadFile(bucketName string, objectKey string, fileName string
 	return err
 }
 
-func (s *S3Base) UploadLargeObject(bucketName string, objectKey string, largeObject []byte) error {
+func (s *S3Base) UploadLargeObject(bucketName string, objectKey string, largeObject []byte, opts ...PutOption) error {
 	largeBuffer := bytes.NewReader(largeObject)
 	var partMiBs int64 = 10
 	uploader := manager.NewUploader(s.S3Client, func(u *manager.Uploader) {
 		u.PartSize = partMiBs * 1024 * 1024
 	})
-	_, err := uploader.Upload(context.TODO(), &s3.PutObjectInput{
+	putOptions := newPutOptions(opts)
+	if err := putOptions.validate(); err != nil {
+		log.Printf("Couldn't upload large object to %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+		return err
+	}
+	if putOptions.ContentType == "" {
+		head := largeObject
+		if len(head) > 512 {
+			head = head[:512]
+		}
+		putOptions.ContentType = DetectContentType(objectKey, head)
+	}
+	input := &s3.PutObjectInput{
 		Bucket: aws.String(bucketName),
 		Key:    aws.String(objectKey),
 		Body:   largeBuffer,
-	})
+	}
+	putOptions.apply(input)
+	if algorithm, ok := putOptions.compression(objectKey); ok {
+		return s.uploadCompressed(context.TODO(), input, largeBuffer, int64(len(largeObject)), algorithm)
+	}
+	_, err := uploader.Upload(context.TODO(), input)
 	if err != nil {
 		log.Printf("Couldn't upload large object to %v:%v. Here's why: %v\n",
 			bucketName, objectKey, err)
@@ -177,89 +250,148 @@ func (s *S3Base) UploadLargeObject(bucketName string, objectKey string, largeObj
 	return err
 }
 
-func (s *S3Base) DownloadFile(bucketName string, objectKey string, fileName string) error {
-	result, err := s.S3Client.GetObject(context.TODO(), &s3.GetObjectInput{
+func (s *S3Base) DownloadFile(bucketName string, objectKey string, fileName string, opts ...GetOption) error {
+	return s.downloadFile(context.TODO(), bucketName, objectKey, fileName, opts...)
+}
+
+func (s *S3Base) downloadFile(ctx context.Context, bucketName string, objectKey string, fileName string, opts ...GetOption) error {
+	input := &s3.GetObjectInput{
 		Bucket: aws.String(bucketName),
 		Key:    aws.String(objectKey),
-	})
+	}
+	newGetOptions(opts).applyGet(input)
+	result, err := s.S3Client.GetObject(ctx, input)
 	if err != nil {
 		log.Printf("Couldn't get object %v:%v. Here's why: %v\n", bucketName, objectKey, err)
 		return err
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			log.Fatalf("body close err: %v", err)
-		}
-	}(result.Body)
+	body, err := decompressBody(result.ContentEncoding, result.Body)
+	if err != nil {
+		log.Printf("Couldn't decompress object %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+		result.Body.Close()
+		return err
+	}
+	defer body.Close()
 	file, err := os.Create(fileName)
 	if err != nil {
 		log.Printf("Couldn't create file %v. Here's why: %v\n", fileName, err)
 		return err
 	}
-
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			log.Fatalf("file close err: %v", err)
-		}
-	}(file)
-
-	body, err := io.ReadAll(result.Body)
-	if err != nil {
+	if _, err = io.Copy(file, body); err != nil {
+		file.Close()
 		log.Printf("Couldn't read object body from %v. Here's why: %v\n", objectKey, err)
+		return err
+	}
+	if err = file.Close(); err != nil {
+		log.Printf("Couldn't write file %v. Here's why: %v\n", fileName, err)
 	}
-	_, err = file.Write(body)
 	return err
 }
 
-func (s *S3Base) DownloadLargeObject(bucketName string, objectKey string) ([]byte, error) {
+// DownloadLargeObject downloads the object in parallel ranged parts and
+// undoes any compression applied by UploadLargeObject. The parts are pinned
+// to the ETag seen by the initial HEAD request, so an overwrite during the
+// download fails instead of mixing two objects.
+func (s *S3Base) DownloadLargeObject(bucketName string, objectKey string, opts ...GetOption) ([]byte, error) {
+	info, err := s.StatObject(bucketName, objectKey, opts...)
+	if err != nil {
+		return nil, err
+	}
 	var partMiBs int64 = 10
 	downloader := manager.NewDownloader(s.S3Client, func(d *manager.Downloader) {
 		d.PartSize = partMiBs * 1024 * 1024
 	})
 	buffer := manager.NewWriteAtBuffer([]byte{})
-	_, err := downloader.Download(context.TODO(), buffer, &s3.GetObjectInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(objectKey),
-	})
+	input := &s3.GetObjectInput{
+		Bucket:  aws.String(bucketName),
+		Key:     aws.String(objectKey),
+		IfMatch: aws.String(`"` + info.ETag + `"`),
+	}
+	newGetOptions(opts).applyGet(input)
+	_, err = downloader.Download(context.TODO(), buffer, input)
 	if err != nil {
 		log.Printf("Couldn't download large object from %v:%v. Here's why: %v\n",
 			bucketName, objectKey, err)
+		return buffer.Bytes(), err
 	}
-	return buffer.Bytes(), err
+	if info.ContentEncoding == "" {
+		return buffer.Bytes(), nil
+	}
+	body, err := decompressBody(aws.String(info.ContentEncoding), io.NopCloser(bytes.NewReader(buffer.Bytes())))
+	if err != nil {
+		log.Printf("Couldn't decompress large object %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+		return nil, err
+	}
+	defer body.Close()
+	content, err := io.ReadAll(body)
+	if err != nil {
+		log.Printf("Couldn't decompress large object %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+		return nil, err
+	}
+	return content, nil
+}
+
+func (s *S3Base) CopyObject(sourceBucket, sourceKey, bucketName, objectKey string, opts ...CopyOption) error {
+	return s.copyObject(context.TODO(), sourceBucket, sourceKey, bucketName, objectKey, opts...)
 }
 
-func (s *S3Base) GetObjectContent(bucketName, key string) (string, error) {
-	output, err := s.S3Client.GetObject(context.TODO(), &s3.GetObjectInput{
+func (s *S3Base) copyObject(ctx context.Context, sourceBucket, sourceKey, bucketName, objectKey string, opts ...CopyOption) error {
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(bucketName),
+		Key:        aws.String(objectKey),
+		CopySource: aws.String((&url.URL{Path: sourceBucket + "/" + sourceKey}).EscapedPath()),
+	}
+	copyOptions := &CopyOptions{}
+	for _, opt := range opts {
+		opt(copyOptions)
+	}
+	if err := copyOptions.Encryption.Validate(); err != nil {
+		return err
+	}
+	copyOptions.apply(input)
+	if copyOptions.SourceVersionId != "" {
+		input.CopySource = aws.String(*input.CopySource + "?versionId=" + url.QueryEscape(copyOptions.SourceVersionId))
+	}
+	_, err := s.S3Client.CopyObject(ctx, input)
+	if err != nil {
+		log.Printf("Couldn't copy object %v:%v to %v:%v. Here's why: %v\n",
+			sourceBucket, sourceKey, bucketName, objectKey, err)
+	}
+	return err
+}
+
+func (s *S3Base) GetObjectContent(bucketName, key string, opts ...GetOption) (string, error) {
+	input := &s3.GetObjectInput{
 		Bucket: &bucketName,
 		Key:    &key,
-	})
+	}
+	return s.getObjectContent(input, opts)
+}
+
+// getObjectContent reads the whole object, undoing any compression applied
+// by UploadFile.
+func (s *S3Base) getObjectContent(input *s3.GetObjectInput, opts []GetOption) (string, error) {
+	newGetOptions(opts).applyGet(input)
+	output, err := s.S3Client.GetObject(context.TODO(), input)
 	if err != nil {
 		return "", err
 	}
-	buf := new(bytes.Buffer)
-	_, err = buf.ReadFrom(output.Body)
+	body, err := decompressBody(output.ContentEncoding, output.Body)
 	if err != nil {
-		log.Fatalf("get object body format err: %v", err)
+		output.Body.Close()
+		return "", err
 	}
-	return buf.String(), err
+	defer body.Close()
+	buf := new(bytes.Buffer)
+	if _, err = buf.ReadFrom(body); err != nil {
+		log.Printf("Couldn't read object body from %v:%v. Here's why: %v\n", *input.Bucket, *input.Key, err)
+		return "", err
+	}
+	return buf.String(), nil
 }
 
 func (s *S3Base) GetObjectUrl(bucketName, key string) (string, error) {
-	presignClient := s3.NewPresignClient(s.S3Client)
-
-	presignParams := &s3.GetObjectInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(key),
-	}
-
-	// Apply an expiration via an option function
-	presignDuration := func(po *s3.PresignOptions) {
-		po.Expires = 5 * time.Minute
-	}
-
-	presignResult, err := presignClient.PresignGetObject(context.TODO(), presignParams, presignDuration)
+	presignResult, err := s.PresignGetObject(bucketName, key, PresignOptions{Expires: DefaultPresignExpires})
 	if err != nil {
 		return "", err
 	}
@@ -280,7 +412,11 @@ func (s *S3Base) GetObjectList(bucketName string) ([]types.Object, error) {
 }
 
 func (s *S3Base) DeleteObject(bucketName string, object types.Object) error {
-	_, err := s.S3Client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+	return s.deleteObject(context.TODO(), bucketName, object)
+}
+
+func (s *S3Base) deleteObject(ctx context.Context, bucketName string, object types.Object) error {
+	_, err := s.S3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: &bucketName,
 		Key:    object.Key,
 	})
@@ -305,66 +441,69 @@ func (s *S3Base) DeleteObjectList(bucketName string, objectList []types.Object)
 	return err
 }
 
+// DeleteObjectListByKeys deletes up to 1000 keys in one request. Keys that
+// S3 couldn't delete are reported in the error.
 func (s *S3Base) DeleteObjectListByKeys(bucketName string, objectKeys []string) error {
+	_, err := s.deleteObjectKeys(context.TODO(), bucketName, objectKeys)
+	return err
+}
+
+// deleteObjectKeys returns the keys that were deleted. DeleteObjects can
+// succeed while failing for single keys, so those are checked as well.
+func (s *S3Base) deleteObjectKeys(ctx context.Context, bucketName string, objectKeys []string) ([]string, error) {
 	var objectIds []types.ObjectIdentifier
 	for _, key := range objectKeys {
 		objectIds = append(objectIds, types.ObjectIdentifier{Key: aws.String(key)})
 	}
-	_, err := s.S3Client.DeleteObjects(context.TODO(), &s3.DeleteObjectsInput{
+	output, err := s.S3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
 		Bucket: aws.String(bucketName),
-		Delete: &types.Delete{Objects: objectIds},
+		Delete: &types.Delete{Objects: objectIds, Quiet: true},
 	})
 	if err != nil {
 		log.Printf("Couldn't delete objects from bucket %v. Here's why: %v\n", bucketName, err)
+		return nil, err
 	}
-	return err
-}
-
-func (s *S3Base) UploadPublicFileAcl(bucketName, objectKey, fileName string) error {
-	file, err := os.Open(fileName)
-	if err != nil {
-		log.Printf("Couldn't open file %v to upload. Here's why: %v\n", fileName, err)
-	} else {
-		defer func(file *os.File) {
-			err := file.Close()
-			if err != nil {
-				log.Fatalf("file close err: %v", err)
-			}
-		}(file)
-
-		_, err := s.S3Client.PutObject(context.TODO(), &s3.PutObjectInput{
-			Bucket: aws.String(bucketName),
-			Key:    aws.String(objectKey),
-			Body:   file,
-			ACL:    types.ObjectCannedACLPublicReadWrite,
-		})
-		if err != nil {
-			log.Printf("Couldn't upload file %v to %v:%v. Here's why: %v\n",
-				fileName, bucketName, objectKey, err)
+	if len(output.Errors) == 0 {
+		return objectKeys, nil
+	}
+	failed := make(map[string]bool, len(output.Errors))
+	for _, e := range output.Errors {
+		failed[aws.ToString(e.Key)] = true
+	}
+	var deleted []string
+	for _, key := range objectKeys {
+		if !failed[key] {
+			deleted = append(deleted, key)
 		}
 	}
-	return err
+	first := output.Errors[0]
+	err = fmt.Errorf("couldn't delete %d objects, first %v (%v): %v",
+		len(output.Errors), aws.ToString(first.Key), aws.ToString(first.Code), aws.ToString(first.Message))
+	log.Printf("Couldn't delete objects from bucket %v. Here's why: %v\n", bucketName, err)
+	return deleted, err
 }
 
-func (s *S3Base) PutPublicObjectAcl(bucketName, objectKey string) error {
-	input := &s3.PutObjectAclInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(objectKey),
-		ACL:    types.ObjectCannedACLPublicReadWrite,
-	}
-
-	_, err := s.S3Client.PutObjectAcl(context.TODO(), input)
-	if err != nil {
+// UploadPublicFileAcl uploads a file with a public-read-write ACL. Put
+// options given with WithPublicUploadOptions, such as encryption, apply as
+// they do for UploadFile.
+func (s *S3Base) UploadPublicFileAcl(bucketName, objectKey, fileName string, opts ...PublicAclOption) error {
+	if err := s.preparePublicAcl(bucketName, opts); err != nil {
 		return err
 	}
-	return nil
+	putOpts := append(newPublicAclOptions(opts).PutOptions, withCannedAcl(types.ObjectCannedACLPublicReadWrite))
+	return s.uploadFile(context.TODO(), bucketName, objectKey, fileName, putOpts...)
+}
+
+func (s *S3Base) PutPublicObjectAcl(bucketName, objectKey string, opts ...PublicAclOption) error {
+	return s.PutObjectCannedAcl(bucketName, objectKey, types.ObjectCannedACLPublicReadWrite, opts...)
 }
 
-func (s *S3Base) DeleteObjectByVersion(bucketName, objectKey, versionId string) error {
+func (s *S3Base) DeleteObjectByVersion(bucketName, objectKey, versionId string, opts ...LockOption) error {
 	input := &s3.DeleteObjectInput{
-		Bucket:    aws.String(bucketName),
-		Key:       aws.String(objectKey),
-		VersionId: aws.String(versionId),
+		Bucket:                    aws.String(bucketName),
+		Key:                       aws.String(objectKey),
+		VersionId:                 aws.String(versionId),
+		BypassGovernanceRetention: newLockOptions(opts).BypassGovernance,
 	}
 	_, err := s.S3Client.DeleteObject(context.TODO(), input)
 	if err != nil {
@@ -374,31 +513,22 @@ func (s *S3Base) DeleteObjectByVersion(bucketName, objectKey, versionId string)
 }
 
 func (s *S3Base) GetObjectVersionList(bucketName string) ([]types.ObjectVersion, error) {
-	input := &s3.ListObjectVersionsInput{
-		Bucket: aws.String(bucketName),
-	}
-	versions, err := s.S3Client.ListObjectVersions(context.TODO(), input)
+	var versions []types.ObjectVersion
+	err := s.listObjectVersionPages(bucketName, "", func(page *s3.ListObjectVersionsOutput) bool {
+		versions = append(versions, page.Versions...)
+		return true
+	})
 	if err != nil {
 		return nil, err
 	}
-	return versions.Versions, nil
+	return versions, nil
 }
 
-func (s *S3Base) GetObjectByVersion(bucketName, objectKey, versionId string) (string, error) {
+func (s *S3Base) GetObjectByVersion(bucketName, objectKey, versionId string, opts ...GetOption) (string, error) {
 	input := &s3.GetObjectInput{
 		Bucket:    &bucketName,
 		Key:       &objectKey,
 		VersionId: &versionId,
 	}
-	output, err := s.S3Client.GetObject(context.TODO(), input)
-	if err != nil {
-		return "", err
-	}
-
-	buf := new(bytes.Buffer)
-	_, err = buf.ReadFrom(output.Body)
-	if err != nil {
-		return "", err
-	}
-	return buf.String(), err
+	return s.getObjectContent(input, opts)
 }
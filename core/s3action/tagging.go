@@ -0,0 +1,257 @@
+package s3action
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// WithTags sets the object tags at upload time.
+func WithTags(tags map[string]string) PutOption {
+	return func(o *PutOptions) {
+		if o.Tags == nil {
+			o.Tags = map[string]string{}
+		}
+		for key, value := range tags {
+			o.Tags[key] = value
+		}
+	}
+}
+
+func encodeTagging(tags map[string]string) *string {
+	if len(tags) == 0 {
+		return nil
+	}
+	values := url.Values{}
+	for key, value := range tags {
+		values.Set(key, value)
+	}
+	return aws.String(values.Encode())
+}
+
+func toTagSet(tags map[string]string) []types.Tag {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	tagSet := make([]types.Tag, len(keys))
+	for i, key := range keys {
+		tagSet[i] = types.Tag{Key: aws.String(key), Value: aws.String(tags[key])}
+	}
+	return tagSet
+}
+
+func fromTagSet(tagSet []types.Tag) map[string]string {
+	tags := make(map[string]string, len(tagSet))
+	for _, tag := range tagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return tags
+}
+
+func (s *S3Base) GetObjectTags(bucketName, objectKey string) (map[string]string, error) {
+	return s.getObjectTags(context.TODO(), bucketName, objectKey)
+}
+
+func (s *S3Base) getObjectTags(ctx context.Context, bucketName, objectKey string) (map[string]string, error) {
+	output, err := s.S3Client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		log.Printf("Couldn't get tags of object %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+		return nil, err
+	}
+	return fromTagSet(output.TagSet), nil
+}
+
+func (s *S3Base) PutObjectTags(bucketName, objectKey string, tags map[string]string) error {
+	_, err := s.S3Client.PutObjectTagging(context.TODO(), &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(bucketName),
+		Key:     aws.String(objectKey),
+		Tagging: &types.Tagging{TagSet: toTagSet(tags)},
+	})
+	if err != nil {
+		log.Printf("Couldn't put tags on object %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+	}
+	return err
+}
+
+func (s *S3Base) DeleteObjectTags(bucketName, objectKey string) error {
+	_, err := s.S3Client.DeleteObjectTagging(context.TODO(), &s3.DeleteObjectTaggingInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		log.Printf("Couldn't delete tags of object %v:%v. Here's why: %v\n", bucketName, objectKey, err)
+	}
+	return err
+}
+
+func (s *S3Base) GetBucketTags(bucketName string) (map[string]string, error) {
+	output, err := s.S3Client.GetBucketTagging(context.TODO(), &s3.GetBucketTaggingInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		log.Printf("Couldn't get tags of bucket %v. Here's why: %v\n", bucketName, err)
+		return nil, err
+	}
+	return fromTagSet(output.TagSet), nil
+}
+
+func (s *S3Base) PutBucketTags(bucketName string, tags map[string]string) error {
+	_, err := s.S3Client.PutBucketTagging(context.TODO(), &s3.PutBucketTaggingInput{
+		Bucket:  aws.String(bucketName),
+		Tagging: &types.Tagging{TagSet: toTagSet(tags)},
+	})
+	if err != nil {
+		log.Printf("Couldn't put tags on bucket %v. Here's why: %v\n", bucketName, err)
+	}
+	return err
+}
+
+func (s *S3Base) DeleteBucketTags(bucketName string) error {
+	_, err := s.S3Client.DeleteBucketTagging(context.TODO(), &s3.DeleteBucketTaggingInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		log.Printf("Couldn't delete tags of bucket %v. Here's why: %v\n", bucketName, err)
+	}
+	return err
+}
+
+type TagPredicate func(tags map[string]string) bool
+
+func HasTag(key string) TagPredicate {
+	return func(tags map[string]string) bool {
+		_, ok := tags[key]
+		return ok
+	}
+}
+
+func TagEquals(key, value string) TagPredicate {
+	return func(tags map[string]string) bool {
+		v, ok := tags[key]
+		return ok && v == value
+	}
+}
+
+func AllTags(predicates ...TagPredicate) TagPredicate {
+	return func(tags map[string]string) bool {
+		for _, predicate := range predicates {
+			if !predicate(tags) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// SelectObjectsByTag lists every object under prefix and fetches its tags
+// concurrently, returning the objects whose tags match predicate. The result
+// can be passed to BatchDelete, BatchCopy or BatchSetStorageClass.
+func (s *S3Base) SelectObjectsByTag(ctx context.Context, bucketName, prefix string, predicate TagPredicate, opts BatchOptions) ([]types.Object, error) {
+	objects, err := s.GetObjectListByPrefix(bucketName, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	matched := make(map[string]bool)
+	_, _, err = RunBatch(ctx, objects, opts, func(ctx context.Context, object types.Object) error {
+		tags, err := s.getObjectTags(ctx, bucketName, aws.ToString(object.Key))
+		if err != nil {
+			return err
+		}
+		if predicate(tags) {
+			mu.Lock()
+			matched[aws.ToString(object.Key)] = true
+			mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []types.Object
+	for _, object := range objects {
+		if matched[aws.ToString(object.Key)] {
+			selected = append(selected, object)
+		}
+	}
+	return selected, nil
+}
+
+func (s *S3Base) GetObjectListByPrefix(bucketName, prefix string) ([]types.Object, error) {
+	return s.getObjectListByPrefix(context.TODO(), bucketName, prefix)
+}
+
+func (s *S3Base) getObjectListByPrefix(ctx context.Context, bucketName, prefix string) ([]types.Object, error) {
+	var contents []types.Object
+	paginator := s3.NewListObjectsV2Paginator(s.S3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucketName),
+		Prefix: optionalString(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			log.Printf("Couldn't list objects in bucket %v. Here's why: %v\n", bucketName, err)
+			return nil, err
+		}
+		contents = append(contents, page.Contents...)
+	}
+	return contents, nil
+}
+
+// SetStorageClass rewrites the object onto itself with a new storage class,
+// keeping its metadata, tags and encryption. An in-place copy would fall
+// back to the bucket default encryption, so SSE-KMS and DSSE-KMS settings
+// are read from the object and SSE-C objects are re-encrypted with the source key given by
+// WithCopySourceSSECustomerKey unless WithCopyEncryption says otherwise.
+func (s *S3Base) SetStorageClass(bucketName, objectKey string, storageClass types.StorageClass, opts ...CopyOption) error {
+	return s.setStorageClass(context.TODO(), bucketName, objectKey, storageClass, opts...)
+}
+
+func (s *S3Base) setStorageClass(ctx context.Context, bucketName, objectKey string, storageClass types.StorageClass, opts ...CopyOption) error {
+	copyOptions := &CopyOptions{}
+	for _, opt := range opts {
+		opt(copyOptions)
+	}
+	if err := s.keepSourceEncryption(ctx, bucketName, objectKey, copyOptions); err != nil {
+		return err
+	}
+	if err := copyOptions.Encryption.Validate(); err != nil {
+		return err
+	}
+	input := &s3.CopyObjectInput{
+		Bucket:            aws.String(bucketName),
+		Key:               aws.String(objectKey),
+		CopySource:        aws.String((&url.URL{Path: bucketName + "/" + objectKey}).EscapedPath()),
+		StorageClass:      storageClass,
+		MetadataDirective: types.MetadataDirectiveCopy,
+		TaggingDirective:  types.TaggingDirectiveCopy,
+	}
+	copyOptions.apply(input)
+	_, err := s.S3Client.CopyObject(ctx, input)
+	if err != nil {
+		log.Printf("Couldn't change storage class of %v:%v to %v. Here's why: %v\n",
+			bucketName, objectKey, storageClass, err)
+	}
+	return err
+}
+
+func (s *S3Base) BatchSetStorageClass(ctx context.Context, bucketName string, objects []types.Object, storageClass types.StorageClass, opts BatchOptions, copyOpts ...CopyOption) ([]BatchResult[types.Object], BatchStats, error) {
+	results, stats, err := RunBatch(ctx, objects, opts, func(ctx context.Context, object types.Object) error {
+		return s.setStorageClass(ctx, bucketName, aws.ToString(object.Key), storageClass, copyOpts...)
+	})
+	logBatchStats("storage class change", bucketName, stats)
+	return results, stats, err
+}
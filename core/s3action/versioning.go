@@ -0,0 +1,312 @@
+package s3action
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// BucketVersioning is the versioning state of a bucket. Status is empty for
+// a bucket that has never had versioning enabled.
+type BucketVersioning struct {
+	Status    types.BucketVersioningStatus
+	MFADelete types.MFADeleteStatus
+}
+
+func (v BucketVersioning) Enabled() bool {
+	return v.Status == types.BucketVersioningStatusEnabled
+}
+
+func (v BucketVersioning) Suspended() bool {
+	return v.Status == types.BucketVersioningStatusSuspended
+}
+
+func (v BucketVersioning) MFADeleteEnabled() bool {
+	return v.MFADelete == types.MFADeleteStatusEnabled
+}
+
+// MFADevice identifies the root account's MFA device and a current code,
+// as required to change MFA delete.
+type MFADevice struct {
+	SerialNumber string
+	Code         string
+}
+
+func (d MFADevice) header() string {
+	return d.SerialNumber + " " + d.Code
+}
+
+func (s *S3Base) GetBucketVersioning(bucketName string) (BucketVersioning, error) {
+	output, err := s.S3Client.GetBucketVersioning(context.TODO(), &s3.GetBucketVersioningInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		log.Printf("Couldn't get versioning of bucket %v. Here's why: %v\n", bucketName, err)
+		return BucketVersioning{}, err
+	}
+	return BucketVersioning{Status: output.Status, MFADelete: output.MFADelete}, nil
+}
+
+func (s *S3Base) putBucketVersioning(bucketName string, config *types.VersioningConfiguration, mfa string) error {
+	_, err := s.S3Client.PutBucketVersioning(context.TODO(), &s3.PutBucketVersioningInput{
+		Bucket:                  aws.String(bucketName),
+		VersioningConfiguration: config,
+		MFA:                     optionalString(mfa),
+	})
+	if err != nil {
+		log.Printf("Couldn't put versioning %v on bucket %v. Here's why: %v\n", config.Status, bucketName, err)
+	}
+	return err
+}
+
+type VersioningOptions struct {
+	MFA *MFADevice
+}
+
+type VersioningOption func(*VersioningOptions)
+
+// WithMFA signs the versioning change with an MFA code. Buckets with MFA
+// delete enabled reject versioning changes without one.
+func WithMFA(device MFADevice) VersioningOption {
+	return func(o *VersioningOptions) {
+		o.MFA = &device
+	}
+}
+
+func (o *VersioningOptions) mfa() string {
+	if o.MFA == nil {
+		return ""
+	}
+	return o.MFA.header()
+}
+
+func newVersioningOptions(opts []VersioningOption) *VersioningOptions {
+	versioningOptions := &VersioningOptions{}
+	for _, opt := range opts {
+		opt(versioningOptions)
+	}
+	return versioningOptions
+}
+
+func (s *S3Base) EnableVersioning(bucketName string, opts ...VersioningOption) error {
+	return s.putBucketVersioning(bucketName, &types.VersioningConfiguration{
+		Status: types.BucketVersioningStatusEnabled,
+	}, newVersioningOptions(opts).mfa())
+}
+
+// SuspendVersioning stops new versions from being created. Existing versions
+// are kept. Buckets with MFA delete enabled need WithMFA.
+func (s *S3Base) SuspendVersioning(bucketName string, opts ...VersioningOption) error {
+	return s.putBucketVersioning(bucketName, &types.VersioningConfiguration{
+		Status: types.BucketVersioningStatusSuspended,
+	}, newVersioningOptions(opts).mfa())
+}
+
+// SetMFADelete turns MFA delete on or off. The bucket must have been
+// versioned, either enabled or suspended, and the request has to be made
+// with the root account's credentials.
+func (s *S3Base) SetMFADelete(bucketName string, enabled bool, device MFADevice) error {
+	current, err := s.GetBucketVersioning(bucketName)
+	if err != nil {
+		return err
+	}
+	if current.Status == "" {
+		return fmt.Errorf("bucket %v: MFA delete requires a versioned bucket", bucketName)
+	}
+	mfaDelete := types.MFADeleteDisabled
+	if enabled {
+		mfaDelete = types.MFADeleteEnabled
+	}
+	return s.putBucketVersioning(bucketName, &types.VersioningConfiguration{
+		Status:    current.Status,
+		MFADelete: mfaDelete,
+	}, device.header())
+}
+
+// BucketOptions configure a new bucket. Object Lock also turns on
+// versioning, which can't be suspended afterwards.
+type BucketOptions struct {
+	ObjectOwnership types.ObjectOwnership
+	Versioning      bool
+	ObjectLock      bool
+}
+
+type BucketOption func(*BucketOptions)
+
+func WithObjectOwnership(ownership types.ObjectOwnership) BucketOption {
+	return func(o *BucketOptions) {
+		o.ObjectOwnership = ownership
+	}
+}
+
+func WithVersioning() BucketOption {
+	return func(o *BucketOptions) {
+		o.Versioning = true
+	}
+}
+
+func newBucketOptions(opts []BucketOption) *BucketOptions {
+	bucketOptions := &BucketOptions{}
+	for _, opt := range opts {
+		opt(bucketOptions)
+	}
+	return bucketOptions
+}
+
+var ErrNoDeleteMarker = errors.New("latest version is not a delete marker")
+
+// ObjectVersion is an entry in a key's history: either a stored version or
+// a delete marker.
+type ObjectVersion struct {
+	Key            string
+	VersionId      string
+	IsLatest       bool
+	IsDeleteMarker bool
+	LastModified   time.Time
+	Size           int64
+	ETag           string
+	StorageClass   types.ObjectVersionStorageClass
+}
+
+// listObjectVersionPages calls fn for each page of versions under prefix
+// until the listing ends or fn returns false.
+func (s *S3Base) listObjectVersionPages(bucketName, prefix string, fn func(page *s3.ListObjectVersionsOutput) bool) error {
+	input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucketName),
+		Prefix: optionalString(prefix),
+	}
+	for {
+		page, err := s.S3Client.ListObjectVersions(context.TODO(), input)
+		if err != nil {
+			log.Printf("Couldn't list object versions in bucket %v. Here's why: %v\n", bucketName, err)
+			return err
+		}
+		if !fn(page) || !page.IsTruncated {
+			return nil
+		}
+		input.KeyMarker, input.VersionIdMarker = page.NextKeyMarker, page.NextVersionIdMarker
+	}
+}
+
+// ObjectVersionsFromPage merges the versions and delete markers of one
+// ListObjectVersions page back into S3's order: by key, then newest first.
+// The SDK returns them as two lists that are each already in that order, so
+// entries are never re-sorted against each other within a list;
+// LastModified only has one-second precision. Across the lists the newer
+// entry goes first, then the one S3 flags as latest, then the delete marker.
+func ObjectVersionsFromPage(page *s3.ListObjectVersionsOutput) []ObjectVersion {
+	versions := make([]ObjectVersion, 0, len(page.Versions)+len(page.DeleteMarkers))
+	i, j := 0, 0
+	for i < len(page.Versions) || j < len(page.DeleteMarkers) {
+		if j == len(page.DeleteMarkers) || (i < len(page.Versions) && versionBeforeMarker(page.Versions[i], page.DeleteMarkers[j])) {
+			v := page.Versions[i]
+			versions = append(versions, ObjectVersion{
+				Key:          aws.ToString(v.Key),
+				VersionId:    aws.ToString(v.VersionId),
+				IsLatest:     v.IsLatest,
+				LastModified: aws.ToTime(v.LastModified),
+				Size:         v.Size,
+				ETag:         aws.ToString(v.ETag),
+				StorageClass: v.StorageClass,
+			})
+			i++
+			continue
+		}
+		m := page.DeleteMarkers[j]
+		versions = append(versions, ObjectVersion{
+			Key:            aws.ToString(m.Key),
+			VersionId:      aws.ToString(m.VersionId),
+			IsLatest:       m.IsLatest,
+			IsDeleteMarker: true,
+			LastModified:   aws.ToTime(m.LastModified),
+		})
+		j++
+	}
+	return versions
+}
+
+func versionBeforeMarker(v types.ObjectVersion, m types.DeleteMarkerEntry) bool {
+	vKey, mKey := aws.ToString(v.Key), aws.ToString(m.Key)
+	if vKey != mKey {
+		return vKey < mKey
+	}
+	vTime, mTime := aws.ToTime(v.LastModified), aws.ToTime(m.LastModified)
+	if !vTime.Equal(mTime) {
+		return vTime.After(mTime)
+	}
+	return v.IsLatest
+}
+
+// ListObjectVersions returns every version and delete marker under prefix,
+// ordered by key and then newest first.
+func (s *S3Base) ListObjectVersions(bucketName, prefix string) ([]ObjectVersion, error) {
+	var versions []ObjectVersion
+	err := s.listObjectVersionPages(bucketName, prefix, func(page *s3.ListObjectVersionsOutput) bool {
+		versions = append(versions, ObjectVersionsFromPage(page)...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// GetObjectHistory returns the versions and delete markers of a single key,
+// newest first. The key sorts before every other key it is a prefix of, so
+// the listing stops at the first entry for a different key.
+func (s *S3Base) GetObjectHistory(bucketName, objectKey string) ([]ObjectVersion, error) {
+	var history []ObjectVersion
+	err := s.listObjectVersionPages(bucketName, objectKey, func(page *s3.ListObjectVersionsOutput) bool {
+		for _, v := range ObjectVersionsFromPage(page) {
+			if v.Key != objectKey {
+				return false
+			}
+			history = append(history, v)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// RestoreVersion makes an old version current again by copying it over the
+// key. The old version is kept, so the restore itself can be undone. Unless
+// WithCopyEncryption is given, the restored copy keeps the old version's
+// encryption, as SetStorageClass does.
+func (s *S3Base) RestoreVersion(bucketName, objectKey, versionId string, opts ...CopyOption) error {
+	return s.restoreVersion(context.TODO(), bucketName, objectKey, versionId, opts...)
+}
+
+func (s *S3Base) restoreVersion(ctx context.Context, bucketName, objectKey, versionId string, opts ...CopyOption) error {
+	opts = append(opts, WithCopySourceVersion(versionId))
+	copyOptions := &CopyOptions{}
+	for _, opt := range opts {
+		opt(copyOptions)
+	}
+	if err := s.keepSourceEncryption(ctx, bucketName, objectKey, copyOptions); err != nil {
+		return err
+	}
+	opts = append(opts, WithCopyEncryption(copyOptions.Encryption))
+	return s.copyObject(ctx, bucketName, objectKey, bucketName, objectKey, opts...)
+}
+
+// Undelete removes the delete marker that hides a key, so the version
+// before it becomes current again.
+func (s *S3Base) Undelete(bucketName, objectKey string) error {
+	history, err := s.GetObjectHistory(bucketName, objectKey)
+	if err != nil {
+		return err
+	}
+	if len(history) == 0 || !history[0].IsDeleteMarker {
+		return fmt.Errorf("%w: %v:%v", ErrNoDeleteMarker, bucketName, objectKey)
+	}
+	return s.DeleteObjectByVersion(bucketName, objectKey, history[0].VersionId)
+}
@@ -0,0 +1,411 @@
+package s3action
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// RoutingRule redirects requests whose key starts with KeyPrefixEquals or
+// that fail with HttpErrorCodeReturnedEquals. Empty fields are left out.
+type RoutingRule struct {
+	KeyPrefixEquals             string
+	HttpErrorCodeReturnedEquals string
+	HostName                    string
+	Protocol                    types.Protocol
+	HttpRedirectCode            string
+	ReplaceKeyPrefixWith        string
+	ReplaceKeyWith              string
+}
+
+type RedirectAllRequestsTo struct {
+	HostName string
+	Protocol types.Protocol
+}
+
+// WebsiteConfig is either a site with an index document or, when
+// RedirectAll is set, a bucket that redirects every request to another host.
+type WebsiteConfig struct {
+	IndexDocument string
+	ErrorDocument string
+	RedirectAll   *RedirectAllRequestsTo
+	RoutingRules  []RoutingRule
+}
+
+// SPAWebsite serves index.html for the root and, since single page apps
+// route on the client, for every missing key too.
+func SPAWebsite() WebsiteConfig {
+	return WebsiteConfig{IndexDocument: "index.html", ErrorDocument: "index.html"}
+}
+
+func (c WebsiteConfig) Validate() error {
+	if c.RedirectAll != nil {
+		if c.RedirectAll.HostName == "" {
+			return fmt.Errorf("redirect-all needs a host name")
+		}
+		if c.IndexDocument != "" || c.ErrorDocument != "" || len(c.RoutingRules) > 0 {
+			return fmt.Errorf("redirect-all can't be combined with documents or routing rules")
+		}
+		return nil
+	}
+	if c.IndexDocument == "" || strings.Contains(c.IndexDocument, "/") {
+		return fmt.Errorf("index document %q must be a file name without slashes", c.IndexDocument)
+	}
+	for i, r := range c.RoutingRules {
+		if r.HostName == "" && r.ReplaceKeyPrefixWith == "" && r.ReplaceKeyWith == "" && r.HttpRedirectCode == "" && r.Protocol == "" {
+			return fmt.Errorf("routing rule %d has no redirect", i)
+		}
+		if r.ReplaceKeyPrefixWith != "" && r.ReplaceKeyWith != "" {
+			return fmt.Errorf("routing rule %d sets both ReplaceKeyPrefixWith and ReplaceKeyWith", i)
+		}
+	}
+	return nil
+}
+
+func (c WebsiteConfig) toSDK() *types.WebsiteConfiguration {
+	if c.RedirectAll != nil {
+		return &types.WebsiteConfiguration{RedirectAllRequestsTo: &types.RedirectAllRequestsTo{
+			HostName: aws.String(c.RedirectAll.HostName),
+			Protocol: c.RedirectAll.Protocol,
+		}}
+	}
+	config := &types.WebsiteConfiguration{IndexDocument: &types.IndexDocument{Suffix: aws.String(c.IndexDocument)}}
+	if c.ErrorDocument != "" {
+		config.ErrorDocument = &types.ErrorDocument{Key: aws.String(c.ErrorDocument)}
+	}
+	for _, r := range c.RoutingRules {
+		rule := types.RoutingRule{Redirect: &types.Redirect{
+			HostName:             optionalString(r.HostName),
+			Protocol:             r.Protocol,
+			HttpRedirectCode:     optionalString(r.HttpRedirectCode),
+			ReplaceKeyPrefixWith: optionalString(r.ReplaceKeyPrefixWith),
+			ReplaceKeyWith:       optionalString(r.ReplaceKeyWith),
+		}}
+		if r.KeyPrefixEquals != "" || r.HttpErrorCodeReturnedEquals != "" {
+			rule.Condition = &types.Condition{
+				KeyPrefixEquals:             optionalString(r.KeyPrefixEquals),
+				HttpErrorCodeReturnedEquals: optionalString(r.HttpErrorCodeReturnedEquals),
+			}
+		}
+		config.RoutingRules = append(config.RoutingRules, rule)
+	}
+	return config
+}
+
+// GetBucketWebsite returns nil if website hosting is not configured.
+func (s *S3Base) GetBucketWebsite(bucketName string) (*WebsiteConfig, error) {
+	output, err := s.S3Client.GetBucketWebsite(context.TODO(), &s3.GetBucketWebsiteInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		if apiErrorCode(err) == "NoSuchWebsiteConfiguration" {
+			return nil, nil
+		}
+		log.Printf("Couldn't get website configuration of bucket %v. Here's why: %v\n", bucketName, err)
+		return nil, err
+	}
+	config := &WebsiteConfig{}
+	if output.RedirectAllRequestsTo != nil {
+		config.RedirectAll = &RedirectAllRequestsTo{
+			HostName: aws.ToString(output.RedirectAllRequestsTo.HostName),
+			Protocol: output.RedirectAllRequestsTo.Protocol,
+		}
+	}
+	if output.IndexDocument != nil {
+		config.IndexDocument = aws.ToString(output.IndexDocument.Suffix)
+	}
+	if output.ErrorDocument != nil {
+		config.ErrorDocument = aws.ToString(output.ErrorDocument.Key)
+	}
+	for _, r := range output.RoutingRules {
+		rule := RoutingRule{}
+		if r.Condition != nil {
+			rule.KeyPrefixEquals = aws.ToString(r.Condition.KeyPrefixEquals)
+			rule.HttpErrorCodeReturnedEquals = aws.ToString(r.Condition.HttpErrorCodeReturnedEquals)
+		}
+		if r.Redirect != nil {
+			rule.HostName = aws.ToString(r.Redirect.HostName)
+			rule.Protocol = r.Redirect.Protocol
+			rule.HttpRedirectCode = aws.ToString(r.Redirect.HttpRedirectCode)
+			rule.ReplaceKeyPrefixWith = aws.ToString(r.Redirect.ReplaceKeyPrefixWith)
+			rule.ReplaceKeyWith = aws.ToString(r.Redirect.ReplaceKeyWith)
+		}
+		config.RoutingRules = append(config.RoutingRules, rule)
+	}
+	return config, nil
+}
+
+func (s *S3Base) PutBucketWebsite(bucketName string, config WebsiteConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	_, err := s.S3Client.PutBucketWebsite(context.TODO(), &s3.PutBucketWebsiteInput{
+		Bucket:               aws.String(bucketName),
+		WebsiteConfiguration: config.toSDK(),
+	})
+	if err != nil {
+		log.Printf("Couldn't put website configuration on bucket %v. Here's why: %v\n", bucketName, err)
+	}
+	return err
+}
+
+func (s *S3Base) DeleteBucketWebsite(bucketName string) error {
+	_, err := s.S3Client.DeleteBucketWebsite(context.TODO(), &s3.DeleteBucketWebsiteInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		log.Printf("Couldn't delete website configuration of bucket %v. Here's why: %v\n", bucketName, err)
+	}
+	return err
+}
+
+var (
+	hashedAssetName = regexp.MustCompile(`[.-]([A-Za-z0-9_]{8,})\.[A-Za-z0-9]+$`)
+	hexHash         = regexp.MustCompile(`^[0-9a-f]+$`)
+)
+
+// isContentHash tells a content hash from a name segment such as a date
+// (photo-20221201.jpg) or a word with a digit (avatar-default1.png). Only
+// lowercase hex, as webpack writes, and mixed-case base64, as Vite writes,
+// count, and the token needs both a digit and a letter.
+func isContentHash(token string) bool {
+	if !strings.ContainsAny(token, "0123456789") || strings.Trim(token, "0123456789") == "" {
+		return false
+	}
+	if hexHash.MatchString(token) {
+		return true
+	}
+	return strings.ToLower(token) != token && strings.ToUpper(token) != token
+}
+
+// DefaultCacheControl keeps HTML always revalidated, caches assets with a
+// content hash in their name (app.3f2a1b9c.js) for a year and everything
+// else for an hour.
+func DefaultCacheControl(objectKey string) string {
+	ext := strings.ToLower(path.Ext(objectKey))
+	if ext == ".html" || ext == ".htm" {
+		return "no-cache"
+	}
+	if m := hashedAssetName.FindStringSubmatch(path.Base(objectKey)); m != nil && isContentHash(m[1]) {
+		return "public, max-age=31536000, immutable"
+	}
+	return "public, max-age=3600"
+}
+
+type DeployOptions struct {
+	Prefix        string
+	IndexDocument string
+	DeleteStale   bool
+	DryRun        bool
+	MaxParallel   int
+	CacheControl  func(objectKey string) string
+}
+
+type DeployReport struct {
+	Uploaded []string
+	Skipped  []string
+	Deleted  []string
+	Bytes    int64
+}
+
+// deployHashMetadata holds the SHA-256 of the uploaded file. ETags can't be
+// used to detect unchanged files: they are not an MD5 for SSE-KMS or
+// multipart objects.
+const deployHashMetadata = "content-sha256"
+
+type deployFile struct {
+	key          string
+	path         string
+	size         int64
+	sha256       string
+	contentType  string
+	cacheControl string
+}
+
+// unchanged reports whether the object already has the file's content and
+// the headers a new upload would set.
+func (f deployFile) unchanged(info *ObjectInfo) bool {
+	return info.Metadata[deployHashMetadata] == f.sha256 &&
+		info.ContentType == f.contentType &&
+		info.CacheControl == f.cacheControl
+}
+
+// DeployWebsite syncs a build directory to the bucket. Files are skipped
+// when the object's stored content hash, Content-Type and Cache-Control
+// all match, index documents are uploaded after every other file so they
+// never reference missing assets, and with DeleteStale objects under Prefix
+// that are not in the directory are removed last.
+func (s *S3Base) DeployWebsite(ctx context.Context, bucketName, dir string, opts DeployOptions) (*DeployReport, error) {
+	if opts.IndexDocument == "" {
+		opts.IndexDocument = "index.html"
+	}
+	if opts.CacheControl == nil {
+		opts.CacheControl = DefaultCacheControl
+	}
+	prefix := opts.Prefix
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	var files []deployFile
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, deployFile{key: prefix + filepath.ToSlash(rel), path: p, size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		log.Printf("Couldn't read build directory %v. Here's why: %v\n", dir, err)
+		return nil, err
+	}
+
+	objects, err := s.GetObjectListByPrefix(bucketName, prefix)
+	if err != nil {
+		return nil, err
+	}
+	remote := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		remote[aws.ToString(object.Key)] = true
+	}
+
+	report := &DeployReport{}
+	local := make(map[string]bool, len(files))
+	for i := range files {
+		f := &files[i]
+		local[f.key] = true
+		if err := f.describe(opts.CacheControl); err != nil {
+			log.Printf("Couldn't read file %v. Here's why: %v\n", f.path, err)
+			return report, err
+		}
+	}
+
+	var mu sync.Mutex
+	skipped := map[string]bool{}
+	_, stats, err := RunBatch(ctx, files, BatchOptions{MaxParallel: opts.MaxParallel, Mode: FailFast}, func(ctx context.Context, f deployFile) error {
+		if !remote[f.key] {
+			return nil
+		}
+		info, err := s.statObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucketName), Key: aws.String(f.key)}, nil)
+		if err != nil {
+			return err
+		}
+		if f.unchanged(info) {
+			mu.Lock()
+			skipped[f.key] = true
+			mu.Unlock()
+		}
+		return nil
+	})
+	logBatchStats("deploy check", bucketName, stats)
+	if err != nil {
+		return report, err
+	}
+
+	var assets, indexes []deployFile
+	for _, f := range files {
+		switch {
+		case skipped[f.key]:
+			report.Skipped = append(report.Skipped, f.key)
+		case path.Base(f.key) == opts.IndexDocument:
+			indexes = append(indexes, f)
+		default:
+			assets = append(assets, f)
+		}
+	}
+
+	upload := func(ctx context.Context, f deployFile) error {
+		if opts.DryRun {
+			return nil
+		}
+		return s.uploadFile(ctx, bucketName, f.key, f.path,
+			WithContentType(f.contentType),
+			WithCacheControl(f.cacheControl),
+			WithMetadata(map[string]string{deployHashMetadata: f.sha256}))
+	}
+	for _, group := range [][]deployFile{assets, indexes} {
+		results, stats, err := RunBatch(ctx, group, BatchOptions{MaxParallel: opts.MaxParallel, Mode: FailFast}, upload)
+		for _, r := range results {
+			if r.Err == nil {
+				report.Uploaded = append(report.Uploaded, r.Item.key)
+				report.Bytes += r.Item.size
+			}
+		}
+		logBatchStats("deploy", bucketName, stats)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	if opts.DeleteStale {
+		var stale []string
+		for key := range remote {
+			if !local[key] {
+				stale = append(stale, key)
+			}
+		}
+		sort.Strings(stale)
+		if opts.DryRun {
+			report.Deleted = stale
+		}
+		for start := 0; start < len(stale) && !opts.DryRun; start += maxDeleteObjects {
+			end := start + maxDeleteObjects
+			if end > len(stale) {
+				end = len(stale)
+			}
+			deleted, err := s.deleteObjectKeys(ctx, bucketName, stale[start:end])
+			report.Deleted = append(report.Deleted, deleted...)
+			if err != nil {
+				return report, err
+			}
+		}
+	}
+	log.Printf("Deployed %v to %v/%v: %d uploaded (%d bytes), %d unchanged, %d deleted\n",
+		dir, bucketName, prefix, len(report.Uploaded), report.Bytes, len(report.Skipped), len(report.Deleted))
+	return report, nil
+}
+
+// describe hashes the file and works out the headers it is uploaded with,
+// detecting the content type the same way UploadFile does.
+func (f *deployFile) describe(cacheControl func(objectKey string) string) error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	putOptions := newPutOptions(nil)
+	if err := putOptions.detectReaderContentType(f.key, file); err != nil {
+		return err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return err
+	}
+	f.sha256 = hex.EncodeToString(h.Sum(nil))
+	f.contentType = putOptions.ContentType
+	f.cacheControl = cacheControl(f.key)
+	return nil
+}
@@ -73,3 +73,204 @@ func (s *PremissionSuite) Test03PutObjectAcl() {
 	s.NoError(err)
 	log.Info(poao)
 }
+
+func (s *PremissionSuite) Test04BucketPolicyDocument() {
+	bucketName := "yuki-testobject-2022-12"
+	policy := s3action.NewPolicyDocument().
+		AllowReadOnlyPrefix(bucketName, "public/", s3action.AnyPrincipal()).
+		DenyInsecureTransport(bucketName).
+		DenyUnencryptedUploads(bucketName)
+	document, err := policy.JSON()
+	s.NoError(err)
+	log.Infof("policy: %v", document)
+
+	parsed, err := s3action.ParsePolicyDocument([]byte(document))
+	s.NoError(err)
+	s.Equal(policy, parsed)
+
+	single := `{"Version":"2012-10-17","Statement":{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::111122223333:root"},` +
+		`"Action":"s3:GetObject","Resource":"arn:aws:s3:::yuki-testobject-2022-12/*","Condition":{"Bool":{"aws:SecureTransport":true}}}}`
+	parsed, err = s3action.ParsePolicyDocument([]byte(single))
+	s.NoError(err)
+	s.Equal(s3action.StringList{"true"}, parsed.Statement[0].Condition["Bool"]["aws:SecureTransport"])
+	s.Equal(s3action.StringList{"arn:aws:iam::111122223333:root"}, parsed.Statement[0].Principal.AWS)
+
+	prefixes := s3action.NewPolicyDocument().
+		AllowReadOnlyPrefix(bucketName, "public/", s3action.AnyPrincipal()).
+		AllowReadOnlyPrefix(bucketName, "shared/images/", s3action.AnyPrincipal())
+	s.NoError(prefixes.Validate())
+	s.Equal("ReadOnlyGetObjectsPublic", prefixes.Statement[0].Sid)
+	s.Equal("ReadOnlyListPrefixSharedImages", prefixes.Statement[3].Sid)
+	s.Error(prefixes.AllowReadOnlyPrefix(bucketName, "public/", s3action.AnyPrincipal()).Validate())
+}
+
+func (s *PremissionSuite) Test05PutBucketPolicy() {
+	bucketName := "yuki-testobject-2022-12"
+	err := s.S3Action.PutBucketPolicy(bucketName, s3action.NewPolicyDocument().DenyInsecureTransport(bucketName))
+	s.NoError(err)
+
+	policy, err := s.S3Action.GetBucketPolicy(bucketName)
+	s.NoError(err)
+	log.Infof("policy: %+v", policy)
+
+	s.NoError(s.S3Action.DeleteBucketPolicy(bucketName))
+}
+
+func (s *PremissionSuite) Test06EvaluatePolicy() {
+	bucketName := "yuki-testobject-2022-12"
+	policy := s3action.NewPolicyDocument().
+		AllowReadOnlyPrefix(bucketName, "public/", s3action.AnyPrincipal()).
+		DenyInsecureTransport(bucketName).
+		AddStatement(s3action.PolicyStatement{
+			Sid:       "OfficeUploads",
+			Effect:    s3action.EffectAllow,
+			Principal: s3action.AWSPrincipal("111122223333"),
+			Action:    s3action.StringList{"s3:Put*"},
+			Resource:  s3action.StringList{s3action.ObjectArn(bucketName, "uploads/*")},
+			Condition: s3action.PolicyConditions{
+				"IpAddress":          {"aws:SourceIp": {"203.0.113.0/24"}},
+				"DateLessThan":       {"aws:CurrentTime": {"2099-01-01T00:00:00Z"}},
+				"StringLikeIfExists": {"s3:x-amz-storage-class": {"STANDARD*"}},
+			},
+		})
+
+	result, err := s3action.EvaluatePolicy(policy, s3action.AccessRequest{
+		Principal: "arn:aws:iam::444455556666:user/guest",
+		Action:    "s3:GetObject",
+		Resource:  s3action.ObjectArn(bucketName, "public/logo.png"),
+		Context:   map[string][]string{"aws:SecureTransport": {"true"}},
+	})
+	s.NoError(err)
+	s.True(result.Allowed())
+	s.Equal("ReadOnlyGetObjectsPublic", policy.Statement[result.DecidingIndex].Sid)
+
+	result, err = s3action.EvaluatePolicy(policy, s3action.AccessRequest{
+		Principal: "arn:aws:iam::444455556666:user/guest",
+		Action:    "s3:GetObject",
+		Resource:  s3action.ObjectArn(bucketName, "public/logo.png"),
+		Context:   map[string][]string{"aws:SecureTransport": {"false"}},
+	})
+	s.NoError(err)
+	s.Equal(s3action.DecisionExplicitDeny, result.Decision)
+	s.Equal("DenyInsecureTransport", policy.Statement[result.DecidingIndex].Sid)
+
+	upload := s3action.AccessRequest{
+		Principal: "arn:aws:iam::111122223333:user/yuki",
+		Action:    "s3:PutObject",
+		Resource:  s3action.ObjectArn(bucketName, "uploads/report.csv"),
+		Context:   map[string][]string{"aws:SecureTransport": {"true"}, "aws:SourceIp": {"203.0.113.7"}},
+	}
+	result, err = s3action.EvaluatePolicy(policy, upload)
+	s.NoError(err)
+	s.True(result.Allowed())
+
+	upload.Context["aws:SourceIp"] = []string{"198.51.100.1"}
+	result, err = s3action.EvaluatePolicy(policy, upload)
+	s.NoError(err)
+	s.Equal(s3action.DecisionImplicitDeny, result.Decision)
+	for _, trace := range result.Trace {
+		log.Infof("statement %v (%v): matched=%v, %v", trace.Index, trace.Sid, trace.Matched, trace.Reason)
+	}
+}
+
+func (s *PremissionSuite) Test07CheckPublicAcl() {
+	bucketName := "yuki-testobject-2022-12"
+	report, err := s.S3Action.CheckPublicAcl(bucketName)
+	if s.NoError(err) {
+		log.Infof("ownership: %v, block: %+v", report.Ownership, report.PublicAccessBlock)
+		for _, problem := range report.Problems {
+			log.Infof("problem: %v", problem)
+		}
+	}
+
+	err = s.S3Action.PutPublicObjectAcl(bucketName, "yuki-test-object-csv", s3action.WithAdjustPublicAccess())
+	s.NoError(err)
+}
+
+func (s *PremissionSuite) Test08AclGrants() {
+	bucketName := "yuki-testobject-2022-12"
+	key := "yuki-test-object-csv"
+
+	acl, err := s.S3Action.GetBucketAcl(bucketName)
+	if !s.NoError(err) {
+		return
+	}
+	log.Infof("owner: %v (%v)", acl.OwnerDisplayName, acl.OwnerID)
+	for _, g := range acl.Grants {
+		log.Infof("Grantee: %v, Type: %v, Permission: %v", g.Grantee(), g.Type, g.Permission)
+	}
+
+	grants := []s3action.Grant{
+		s3action.GrantCanonicalUser(acl.OwnerID, types.PermissionFullControl),
+		s3action.GrantGroup(s3action.LogDeliveryGroup, types.PermissionWrite),
+		s3action.GrantGroup(s3action.LogDeliveryGroup, types.PermissionReadAcp),
+	}
+	s.NoError(s.S3Action.PutBucketGrants(bucketName, grants))
+
+	s.Error(s.S3Action.PutBucketGrants(bucketName, []s3action.Grant{{Type: types.TypeGroup, Permission: types.PermissionRead}}))
+
+	err = s.S3Action.PutObjectCannedAcl(bucketName, key, types.ObjectCannedACLBucketOwnerFullControl)
+	s.NoError(err)
+	objectAcl, err := s.S3Action.GetObjectAcl(bucketName, key)
+	if s.NoError(err) {
+		s.Empty(objectAcl.PublicGrants())
+	}
+}
+
+func (s *PremissionSuite) Test09ExposureFindings() {
+	bucketName := "yuki-testobject-2022-12"
+	acl := &s3action.AccessControlList{
+		OwnerID: "owner",
+		Grants: []s3action.Grant{
+			s3action.GrantCanonicalUser("owner", types.PermissionFullControl),
+			s3action.GrantGroup(s3action.AllUsersGroup, types.PermissionWrite),
+			s3action.GrantGroup(s3action.AuthenticatedUsersGroup, types.PermissionRead),
+		},
+	}
+	findings := s3action.AclExposure(bucketName, "", acl, s3action.PublicAccessBlock{})
+	if s.Len(findings, 2) {
+		s.Equal(s3action.SeverityCritical, findings[0].Severity)
+		s.Equal(s3action.SeverityMedium, findings[1].Severity)
+	}
+	findings = s3action.AclExposure(bucketName, "a.csv", acl, s3action.PublicAccessBlock{IgnorePublicAcls: true})
+	for _, f := range findings {
+		s.Equal(s3action.SeverityLow, f.Severity)
+	}
+
+	policy := s3action.NewPolicyDocument().
+		AllowReadOnlyPrefix(bucketName, "public/", s3action.AnyPrincipal()).
+		DenyInsecureTransport(bucketName)
+	findings = s3action.PolicyExposure(bucketName, policy, s3action.PublicAccessBlock{})
+	if s.Len(findings, 2) {
+		s.Equal(s3action.SeverityHigh, findings[0].Severity)
+		s.Equal(s3action.SeverityMedium, findings[1].Severity)
+	}
+
+	allExcept := s3action.NewPolicyDocument().AddStatement(s3action.PolicyStatement{
+		Effect:       s3action.EffectAllow,
+		NotPrincipal: s3action.AWSPrincipal("arn:aws:iam::111122223333:user/blocked"),
+		Action:       s3action.StringList{"s3:ListBucket"},
+		Resource:     s3action.StringList{s3action.BucketArn(bucketName)},
+		Condition:    s3action.PolicyConditions{"Bool": {"aws:SecureTransport": {"true"}}},
+	})
+	findings = s3action.PolicyExposure(bucketName, allExcept, s3action.PublicAccessBlock{})
+	if s.Len(findings, 1) {
+		s.Equal(s3action.SeverityHigh, findings[0].Severity)
+	}
+}
+
+func (s *PremissionSuite) Test10AuditPublicExposure() {
+	regional := s.S3Action.ForRegion("eu-central-1")
+	s.Equal(s.S3Action.RetryMetrics, regional.RetryMetrics)
+	s.Same(regional, regional.ForRegion("eu-central-1"))
+
+	report, err := s.S3Action.AuditPublicExposure(context.TODO(), s3action.AuditOptions{ObjectSampleSize: 20, MaxParallel: 4})
+	if s.NoError(err) {
+		for _, f := range report.Findings {
+			log.Infof("%v", f)
+		}
+		for bucket, err := range report.Errors {
+			log.Infof("couldn't audit %v: %v", bucket, err)
+		}
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"context"
 	"testing"
+	"time"
 
 	"s3-demo/core/s3action"
 	"s3-demo/log"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/stretchr/testify/suite"
@@ -17,6 +19,8 @@ type VersionSuite struct {
 	suite.Suite
 	S3Action s3action.S3Base
 	Region   string
+	// TempBuckets are deleted again in TearDownSuite.
+	TempBuckets []string
 }
 
 func TestVersionSuite(t *testing.T) {
@@ -28,6 +32,12 @@ func (s *VersionSuite) SetupSuite() {
 	s.Region = "us-west-2"
 }
 
+func (s *VersionSuite) TearDownSuite() {
+	for _, bucketName := range s.TempBuckets {
+		s.NoError(s.S3Action.DeleteBucket(bucketName))
+	}
+}
+
 func (s *VersionSuite) Test01PutBucketVersion() {
 	bucketName := "yuki-testbucket-version-2022-12"
 	err := s.S3Action.CreateBucket(bucketName, s.Region)
@@ -96,3 +106,279 @@ func (s *VersionSuite) Test05GetObjectVersionList() {
 		log.Infof("ver: %v", *v.VersionId)
 	}
 }
+
+func (s *VersionSuite) Test06VersioningStatus() {
+	bucketName := "yuki-testbucket-version-2022-12"
+	err := s.S3Action.SuspendVersioning(bucketName)
+	s.NoError(err)
+	versioning, err := s.S3Action.GetBucketVersioning(bucketName)
+	if s.NoError(err) {
+		s.True(versioning.Suspended())
+		log.Infof("versioning: %v, mfa delete: %v", versioning.Status, versioning.MFADelete)
+	}
+
+	err = s.S3Action.EnableVersioning(bucketName)
+	s.NoError(err)
+	versioning, err = s.S3Action.GetBucketVersioning(bucketName)
+	if s.NoError(err) {
+		s.True(versioning.Enabled())
+	}
+}
+
+func (s *VersionSuite) Test07CreateBucketWithVersioning() {
+	bucketName := "yuki-testbucket-version-2022-12-b"
+	err := s.S3Action.CreateBucket(bucketName, s.Region, s3action.WithVersioning())
+	if !s.NoError(err) {
+		return
+	}
+	s.TempBuckets = append(s.TempBuckets, bucketName)
+
+	versioning, err := s.S3Action.GetBucketVersioning(bucketName)
+	if s.NoError(err) {
+		s.True(versioning.Enabled())
+	}
+	acl, err := s.S3Action.GetBucketAcl(bucketName)
+	if s.NoError(err) {
+		s.Empty(acl.PublicGrants())
+	}
+}
+
+func (s *VersionSuite) Test08VersionHistory() {
+	bucketName := "yuki-testbucket-version-2022-12"
+	key := "yuki-testobject-version-2022-12"
+
+	s.NoError(s.S3Action.UploadFile(bucketName, key, "test.csv"))
+	history, err := s.S3Action.GetObjectHistory(bucketName, key)
+	if !s.NoError(err) || !s.NotEmpty(history) {
+		return
+	}
+	s.True(history[0].IsLatest)
+	for _, v := range history {
+		log.Infof("%v %v latest=%v deleteMarker=%v %v", v.Key, v.VersionId, v.IsLatest, v.IsDeleteMarker, v.LastModified)
+	}
+	firstVersion := history[len(history)-1]
+
+	s.NoError(s.S3Action.DeleteObject(bucketName, types.Object{Key: &key}))
+	s.NoError(s.S3Action.Undelete(bucketName, key))
+	s.ErrorIs(s.S3Action.Undelete(bucketName, key), s3action.ErrNoDeleteMarker)
+
+	if !firstVersion.IsDeleteMarker {
+		s.NoError(s.S3Action.RestoreVersion(bucketName, key, firstVersion.VersionId))
+	}
+}
+
+func (s *VersionSuite) Test09PlanPointInTimeRestore() {
+	t0 := time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC)
+	versions := []s3action.ObjectVersion{
+		{Key: "a.csv", VersionId: "a3", IsLatest: true, LastModified: t0.Add(3 * time.Hour)},
+		{Key: "a.csv", VersionId: "a1", LastModified: t0.Add(time.Hour)},
+		{Key: "b.csv", VersionId: "b2", IsLatest: true, LastModified: t0.Add(2 * time.Hour)},
+		{Key: "c.csv", VersionId: "c2", IsLatest: true, IsDeleteMarker: true, LastModified: t0.Add(3 * time.Hour)},
+		{Key: "c.csv", VersionId: "c1", LastModified: t0},
+		{Key: "d.csv", VersionId: "d1", IsLatest: true, LastModified: t0},
+	}
+	entries := s3action.PlanPointInTimeRestore(versions, t0.Add(90*time.Minute))
+	if !s.Len(entries, 4) {
+		return
+	}
+	s.Equal(s3action.RestoreActionRestore, entries[0].Action)
+	s.Equal("a1", entries[0].VersionId)
+	s.Equal(s3action.RestoreActionDelete, entries[1].Action)
+	s.Equal(s3action.RestoreActionRestore, entries[2].Action)
+	s.Equal("c1", entries[2].VersionId)
+	s.Equal(s3action.RestoreActionUnchanged, entries[3].Action)
+}
+
+func (s *VersionSuite) Test10RestorePrefixToPointInTime() {
+	bucketName := "yuki-testbucket-version-2022-12"
+	report, err := s.S3Action.RestorePrefixToPointInTime(context.TODO(), bucketName, "yuki-testobject",
+		time.Now().Add(-time.Hour), s3action.PointInTimeOptions{DryRun: true})
+	if s.NoError(err) {
+		for _, e := range report.Entries {
+			log.Infof("%v: %v %v (current %v)", e.Key, e.Action, e.VersionId, e.CurrentVersionId)
+		}
+	}
+}
+
+func (s *VersionSuite) Test11PlanPrune() {
+	now := time.Date(2022, 12, 31, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	versions := []s3action.ObjectVersion{
+		{Key: "a.csv", VersionId: "a4", IsLatest: true, LastModified: now.Add(-day), Size: 40},
+		{Key: "a.csv", VersionId: "a3", LastModified: now.Add(-2 * day), Size: 30},
+		{Key: "a.csv", VersionId: "a2", LastModified: now.Add(-10 * day), Size: 20},
+		{Key: "a.csv", VersionId: "a1", LastModified: now.Add(-20 * day), Size: 10},
+		{Key: "b.csv", VersionId: "b2", IsLatest: true, IsDeleteMarker: true, LastModified: now.Add(-30 * day)},
+		{Key: "b.csv", VersionId: "b1", LastModified: now.Add(-40 * day), Size: 5},
+	}
+
+	_, err := s3action.PlanPrune(versions, s3action.PruneOptions{}, now)
+	s.ErrorIs(err, s3action.ErrNoRetentionRule)
+
+	prune, err := s3action.PlanPrune(versions, s3action.PruneOptions{KeepVersions: 2, RemoveOrphanedDeleteMarkers: true}, now)
+	if s.NoError(err) && s.Len(prune, 2) {
+		s.Equal("a2", prune[0].VersionId)
+		s.Equal("a1", prune[1].VersionId)
+	}
+
+	prune, err = s3action.PlanPrune(versions, s3action.PruneOptions{KeepNewerThan: 15 * day}, now)
+	if s.NoError(err) && s.Len(prune, 2) {
+		s.Equal("a1", prune[0].VersionId)
+		s.Equal("b1", prune[1].VersionId)
+	}
+
+	prune, err = s3action.PlanPrune(versions, s3action.PruneOptions{KeepNewerThan: 15 * day, RemoveOrphanedDeleteMarkers: true}, now)
+	if s.NoError(err) && s.Len(prune, 3) {
+		s.True(prune[2].IsDeleteMarker)
+	}
+}
+
+func (s *VersionSuite) Test12PruneVersions() {
+	bucketName := "yuki-testbucket-version-2022-12"
+	report, err := s.S3Action.PruneVersions(context.TODO(), bucketName, "", s3action.PruneOptions{
+		KeepVersions:                3,
+		RemoveOrphanedDeleteMarkers: true,
+		DryRun:                      true,
+	})
+	if s.NoError(err) {
+		log.Infof("would delete %d versions and %d delete markers, reclaiming %d bytes",
+			report.VersionsDeleted, report.DeleteMarkersRemoved, report.BytesReclaimed)
+	}
+}
+
+func (s *VersionSuite) Test13UnifiedDiff() {
+	from := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n"
+	to := "a\nb\nc\nD\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\n"
+	s.Equal(""+
+		"--- cfg@v1\n"+
+		"+++ cfg@v2\n"+
+		"@@ -1,7 +1,7 @@\n"+
+		" a\n b\n c\n-d\n+D\n e\n f\n g\n"+
+		"@@ -11,3 +11,4 @@\n"+
+		" k\n l\n m\n+n\n",
+		s3action.UnifiedDiff("cfg@v1", "cfg@v2", from, to))
+	s.Empty(s3action.UnifiedDiff("cfg@v1", "cfg@v2", from, from))
+
+	s.Equal(""+
+		"--- cfg@v1\n"+
+		"+++ cfg@v2\n"+
+		"@@ -1,2 +1,2 @@\n"+
+		" a\n-b\n+b\n"+
+		"\\ No newline at end of file\n",
+		s3action.UnifiedDiff("cfg@v1", "cfg@v2", "a\nb\n", "a\nb"))
+	s.Equal(""+
+		"--- cfg@v1\n"+
+		"+++ cfg@v2\n"+
+		"@@ -1 +1 @@\n"+
+		"-a\n"+
+		"\\ No newline at end of file\n"+
+		"+b\n"+
+		"\\ No newline at end of file\n",
+		s3action.UnifiedDiff("cfg@v1", "cfg@v2", "a", "b"))
+}
+
+func (s *VersionSuite) Test14DiffVersions() {
+	bucketName := "yuki-testbucket-version-2022-12"
+	key := "yuki-testobject-version-2022-12"
+	history, err := s.S3Action.GetObjectHistory(bucketName, key)
+	if !s.NoError(err) || len(history) < 2 || history[0].IsDeleteMarker || history[1].IsDeleteMarker {
+		return
+	}
+	diff, err := s.S3Action.DiffVersions(bucketName, key, history[1].VersionId, history[0].VersionId)
+	if s.NoError(err) {
+		log.Infof("%v", diff)
+	}
+}
+
+// Test15ObjectLock uses a fixed bucket that is created on the first run and
+// reused afterwards: Object Lock can't be turned off, so the bucket is not
+// deleted in TearDownSuite.
+func (s *VersionSuite) Test15ObjectLock() {
+	bucketName := "yuki-testbucket-lock-2022-12"
+	key := "audit/2022-12.csv"
+
+	s.Error(s3action.DefaultRetention{Mode: types.ObjectLockRetentionModeGovernance}.Validate())
+	s.Error(s3action.ObjectRetention{Mode: "WORM", RetainUntil: time.Now()}.Validate())
+	s.Error(s.S3Action.UploadFile(bucketName, key, "test.csv",
+		s3action.WithRetention(s3action.ObjectRetention{Mode: types.ObjectLockRetentionModeGovernance})))
+
+	exists, err := s.S3Action.BucketExists(bucketName)
+	if !s.NoError(err) {
+		return
+	}
+	if !exists {
+		s.NoError(s.S3Action.CreateBucket(bucketName, s.Region, s3action.WithObjectLock()))
+	}
+	err = s.S3Action.PutDefaultRetention(bucketName, &s3action.DefaultRetention{
+		Mode: types.ObjectLockRetentionModeGovernance,
+		Days: 1,
+	})
+	s.NoError(err)
+	config, err := s.S3Action.GetObjectLockConfiguration(bucketName)
+	if s.NoError(err) {
+		s.True(config.Enabled)
+		s.NotNil(config.DefaultRetention)
+	}
+
+	retainUntil := time.Now().Add(time.Hour)
+	err = s.S3Action.UploadFile(bucketName, key, "test.csv",
+		s3action.WithRetention(s3action.GovernanceRetention(retainUntil)), s3action.WithLegalHold())
+	s.NoError(err)
+	info, err := s.S3Action.StatObject(bucketName, key)
+	if !s.NoError(err) {
+		return
+	}
+	retention, err := s.S3Action.GetObjectRetention(bucketName, key, info.VersionId)
+	if s.NoError(err) && s.NotNil(retention) {
+		s.Equal(types.ObjectLockRetentionModeGovernance, retention.Mode)
+	}
+
+	s.Error(s.S3Action.DeleteObjectByVersion(bucketName, key, info.VersionId, s3action.WithBypassGovernance()))
+	s.NoError(s.S3Action.PutObjectLegalHold(bucketName, key, info.VersionId, false))
+	held, err := s.S3Action.GetObjectLegalHold(bucketName, key, info.VersionId)
+	s.NoError(err)
+	s.False(held)
+
+	s.Error(s.S3Action.DeleteObjectByVersion(bucketName, key, info.VersionId))
+	s.NoError(s.S3Action.DeleteObjectByVersion(bucketName, key, info.VersionId, s3action.WithBypassGovernance()))
+}
+
+func (s *VersionSuite) Test16ObjectVersionsFromPage() {
+	second := time.Date(2022, 12, 20, 10, 0, 0, 0, time.UTC)
+	page := &s3.ListObjectVersionsOutput{
+		Versions: []types.ObjectVersion{
+			{Key: aws.String("a.txt"), VersionId: aws.String("v3"), LastModified: aws.Time(second)},
+			{Key: aws.String("a.txt"), VersionId: aws.String("v2"), LastModified: aws.Time(second)},
+			{Key: aws.String("a.txt"), VersionId: aws.String("v1"), LastModified: aws.Time(second.Add(-time.Minute))},
+			{Key: aws.String("b.txt"), VersionId: aws.String("v1"), IsLatest: true, LastModified: aws.Time(second)},
+		},
+		DeleteMarkers: []types.DeleteMarkerEntry{
+			{Key: aws.String("a.txt"), VersionId: aws.String("m1"), IsLatest: true, LastModified: aws.Time(second)},
+		},
+	}
+	var order []string
+	for _, v := range s3action.ObjectVersionsFromPage(page) {
+		order = append(order, v.Key+"@"+v.VersionId)
+	}
+	s.Equal([]string{"a.txt@m1", "a.txt@v3", "a.txt@v2", "a.txt@v1", "b.txt@v1"}, order)
+}
+
+func (s *VersionSuite) Test17RestoreKMSVersion() {
+	bucketName := "yuki-testbucket-version-2022-12"
+	key := "yuki-testobject-version-kms-2022-12"
+
+	s.NoError(s.S3Action.UploadFile(bucketName, key, "test.csv", s3action.WithEncryption(s3action.SSEKMS(""))))
+	encrypted, err := s.S3Action.StatObject(bucketName, key)
+	if !s.NoError(err) {
+		return
+	}
+	s.NoError(s.S3Action.UploadFile(bucketName, key, "test.csv"))
+
+	s.NoError(s.S3Action.RestoreVersion(bucketName, key, encrypted.VersionId))
+	restored, err := s.S3Action.StatObject(bucketName, key)
+	if s.NoError(err) {
+		s.NotEqual(encrypted.VersionId, restored.VersionId)
+		s.Equal(types.ServerSideEncryptionAwsKms, restored.ServerSideEncryption)
+		s.Equal(encrypted.SSEKMSKeyId, restored.SSEKMSKeyId)
+	}
+}
@@ -0,0 +1,107 @@
+package example06retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"s3-demo/core/s3action"
+	"s3-demo/log"
+
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/suite"
+)
+
+type RetrySuite struct {
+	suite.Suite
+	S3Action   *s3action.S3Base
+	BucketName string
+	Limiter    *s3action.RateLimiter
+}
+
+func TestRetrySuite(t *testing.T) {
+	suite.Run(t, new(RetrySuite))
+}
+
+func (s *RetrySuite) SetupSuite() {
+	s.BucketName = "yuki-testobject-2022-12"
+	limiter, err := s3action.NewRateLimiter(50, 1, 100)
+	s.Require().NoError(err)
+	s.Limiter = limiter
+
+	policy := s3action.DefaultRetryPolicy()
+	policy.MaxAttempts = 8
+	listPolicy := s3action.DefaultRetryPolicy()
+	listPolicy.MaxAttempts = 2
+	s.S3Action = s3action.NewS3Client(
+		s3action.WithRetryPolicy(policy),
+		s3action.WithOperationRetryPolicy("ListObjectsV2", listPolicy),
+		s3action.WithRateLimiter(s.Limiter),
+	)
+}
+
+func (s *RetrySuite) Test01RetryPolicy() {
+	policy := s3action.DefaultRetryPolicy()
+	policy.MaxAttempts = 3
+	retryer := policy.NewRetryer()
+	s.Equal(3, retryer.MaxAttempts())
+
+	s.True(retryer.IsErrorRetryable(&smithy.GenericAPIError{Code: "SlowDown"}))
+	s.False(retryer.IsErrorRetryable(&smithy.GenericAPIError{Code: "AccessDenied"}))
+	s.False(s3action.IsRetryableError(errors.New("no such file")))
+
+	for attempt := 1; attempt < 10; attempt++ {
+		delay, err := retryer.RetryDelay(attempt, &smithy.GenericAPIError{Code: "SlowDown"})
+		s.NoError(err)
+		s.LessOrEqual(delay, policy.MaxBackoff)
+	}
+}
+
+func (s *RetrySuite) Test02RateLimiter() {
+	limiter, err := s3action.NewRateLimiter(10, 1, 20)
+	s.Require().NoError(err)
+	key := limiter.LimitKey(s.BucketName, "logs/2022/12/app.log")
+	s.Equal(s.BucketName+"/logs", key)
+	s.Equal(s.BucketName, limiter.LimitKey(s.BucketName, "app.log"))
+
+	limiter.Feedback(key, true)
+	s.Equal(float64(5), limiter.Rate(key))
+	limiter.Feedback(key, false)
+	s.Equal(5.2, limiter.Rate(key))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	s.NoError(limiter.Wait(ctx, key))
+}
+
+func (s *RetrySuite) Test03ListWithRetry() {
+	objects, err := s.S3Action.GetObjectList(s.BucketName)
+	s.NoError(err)
+	log.Infof("objects: %v", len(objects))
+	for op, stats := range s.S3Action.RetryMetrics.Snapshot() {
+		log.Infof("op: %v, attempts: %v, retries: %v, throttles: %v", op, stats.Attempts, stats.Retries, stats.Throttles)
+	}
+	log.Infof("rate: %v", s.Limiter.Rate(s.Limiter.LimitKey(s.BucketName, "")))
+}
+
+func (s *RetrySuite) Test04SlowRateLimiter() {
+	_, err := s3action.NewRateLimiter(0, 0, 1)
+	s.Error(err)
+
+	limiter, err := s3action.NewRateLimiter(0.5, 0.5, 1)
+	s.Require().NoError(err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	s.NoError(limiter.Wait(ctx, "slow"))
+	s.NoError(limiter.Wait(ctx, "slow"))
+	elapsed := time.Since(start)
+	s.GreaterOrEqual(elapsed, 1500*time.Millisecond)
+	s.Less(elapsed, 3*time.Second)
+
+	var unlimited s3action.RateLimiter
+	s.NoError(unlimited.Wait(ctx, "any"))
+	unlimited.Feedback("any", true)
+}
@@ -0,0 +1,104 @@
+package example07batch
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"s3-demo/core/s3action"
+	"s3-demo/log"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type BatchSuite struct {
+	suite.Suite
+	S3Action   *s3action.S3Base
+	BucketName string
+	FileName   string
+}
+
+func TestBatchSuite(t *testing.T) {
+	suite.Run(t, new(BatchSuite))
+}
+
+func (s *BatchSuite) SetupSuite() {
+	s.S3Action = s3action.NewS3Client()
+	s.BucketName = "yuki-testobject-2022-12"
+	s.FileName = "test.csv"
+}
+
+func (s *BatchSuite) Test01MaxParallel() {
+	items := make([]int, 20)
+	var running, peak int32
+	results, stats, err := s3action.RunBatch(context.Background(), items, s3action.BatchOptions{MaxParallel: 3},
+		func(ctx context.Context, item int) error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil
+		})
+	s.NoError(err)
+	s.Len(results, 20)
+	s.Equal(20, stats.Succeeded)
+	s.LessOrEqual(peak, int32(3))
+}
+
+func (s *BatchSuite) Test02FailFast() {
+	items := []int{0, 1, 2, 3, 4, 5, 6, 7}
+	failure := errors.New("boom")
+	_, stats, err := s3action.RunBatch(context.Background(), items, s3action.BatchOptions{MaxParallel: 1, Mode: s3action.FailFast},
+		func(ctx context.Context, item int) error {
+			if item == 2 {
+				return failure
+			}
+			return nil
+		})
+	s.ErrorIs(err, failure)
+	s.Equal(2, stats.Succeeded)
+	s.Equal(1, stats.Failed)
+	s.Equal(5, stats.Skipped)
+
+	_, stats, err = s3action.RunBatch(context.Background(), items, s3action.BatchOptions{MaxParallel: 2},
+		func(ctx context.Context, item int) error {
+			if item%2 == 0 {
+				return failure
+			}
+			return nil
+		})
+	s.ErrorIs(err, failure)
+	s.Equal(4, stats.Succeeded)
+	s.Equal(4, stats.Failed)
+}
+
+func (s *BatchSuite) Test03Cancel() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, stats, err := s3action.RunBatch(ctx, []int{1, 2, 3}, s3action.BatchOptions{MaxParallel: 2},
+		func(ctx context.Context, item int) error { return nil })
+	s.ErrorIs(err, s3action.ErrBatchSkipped)
+	s.ErrorIs(err, context.Canceled)
+	s.Equal(3, stats.Skipped)
+}
+
+func (s *BatchSuite) Test04BatchUpload() {
+	items := []s3action.UploadItem{
+		{ObjectKey: "batch/test-1.csv", FileName: s.FileName},
+		{ObjectKey: "batch/test-2.csv", FileName: s.FileName},
+		{ObjectKey: "batch/test-3.csv", FileName: s.FileName},
+	}
+	results, stats, err := s.S3Action.BatchUpload(context.TODO(), s.BucketName, items, s3action.BatchOptions{MaxParallel: 2})
+	s.NoError(err)
+	for _, r := range results {
+		log.Infof("upload %v: %v, %v", r.Item.ObjectKey, r.Err, r.Duration)
+	}
+	log.Infof("stats: %+v", stats)
+}
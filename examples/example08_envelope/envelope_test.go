@@ -0,0 +1,90 @@
+package example08envelope
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"s3-demo/core/s3action"
+	"s3-demo/log"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type EnvelopeSuite struct {
+	suite.Suite
+	S3Action   *s3action.S3Base
+	Crypto     *s3action.EncryptionClient
+	Keyring    *s3action.LocalKeyring
+	BucketName string
+	FileName   string
+	ObjectKey  string
+}
+
+func TestEnvelopeSuite(t *testing.T) {
+	suite.Run(t, new(EnvelopeSuite))
+}
+
+func (s *EnvelopeSuite) SetupSuite() {
+	s.S3Action = s3action.NewS3Client()
+	s.BucketName = "yuki-testobject-2022-12"
+	s.FileName = "test.csv"
+	s.ObjectKey = "yuki-test-object-encrypted-csv"
+	s.Keyring = s3action.NewLocalKeyring()
+	s.NoError(s.Keyring.GenerateKey("test-key-1"))
+	s.Crypto = s3action.NewEncryptionClient(s.S3Action, s.Keyring)
+	s.Crypto.ChunkSize = 16
+}
+
+func (s *EnvelopeSuite) Test01Keyring() {
+	path := filepath.Join(s.T().TempDir(), "keyring.json")
+	s.NoError(s.Keyring.Save(path))
+
+	loaded, err := s3action.LoadLocalKeyring(path)
+	s.NoError(err)
+	keyId, wrapped, err := s.Keyring.WrapKey([]byte("0123456789abcdef0123456789abcdef"))
+	s.NoError(err)
+	s.Equal("test-key-1", keyId)
+	dataKey, err := loaded.UnwrapKey(keyId, wrapped)
+	s.NoError(err)
+	s.Equal("0123456789abcdef0123456789abcdef", string(dataKey))
+
+	_, err = loaded.UnwrapKey("missing", wrapped)
+	s.Error(err)
+}
+
+func (s *EnvelopeSuite) Test02UploadEncrypted() {
+	err := s.Crypto.UploadFile(s.BucketName, s.ObjectKey, s.FileName)
+	s.NoError(err)
+
+	raw, err := s.S3Action.GetObjectContent(s.BucketName, s.ObjectKey)
+	s.NoError(err)
+	log.Infof("stored ciphertext bytes: %v", len(raw))
+
+	err = s.Crypto.UploadFile(s.BucketName, s.ObjectKey, s.FileName,
+		s3action.WithCompression(s3action.DefaultCompressionPolicy(s3action.CompressionGzip)))
+	s.Error(err)
+}
+
+func (s *EnvelopeSuite) Test03DownloadDecrypted() {
+	expected, err := os.ReadFile(s.FileName)
+	s.NoError(err)
+
+	content, err := s.Crypto.GetObjectContent(s.BucketName, s.ObjectKey)
+	s.NoError(err)
+	s.Equal(string(expected), content)
+
+	body, err := s.Crypto.GetObject(s.BucketName, s.ObjectKey)
+	if s.NoError(err) {
+		defer body.Close()
+		streamed, err := io.ReadAll(body)
+		s.NoError(err)
+		s.Equal(expected, streamed)
+	}
+
+	part, err := s.Crypto.GetObjectRange(s.BucketName, s.ObjectKey, 2, 5)
+	if s.NoError(err) {
+		s.Equal(expected[2:7], part)
+	}
+}
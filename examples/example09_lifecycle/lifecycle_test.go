@@ -0,0 +1,83 @@
+package example09lifecycle
+
+import (
+	"testing"
+
+	"s3-demo/core/s3action"
+	"s3-demo/log"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/suite"
+)
+
+type LifecycleSuite struct {
+	suite.Suite
+	S3Action   *s3action.S3Base
+	BucketName string
+}
+
+func TestLifecycleSuite(t *testing.T) {
+	suite.Run(t, new(LifecycleSuite))
+}
+
+func (s *LifecycleSuite) SetupSuite() {
+	s.S3Action = s3action.NewS3Client()
+	s.BucketName = "yuki-testbucket-version-2022-12"
+}
+
+func (s *LifecycleSuite) rules() []s3action.LifecycleRule {
+	return []s3action.LifecycleRule{
+		*s3action.NewLifecycleRule("expire-logs").
+			WithPrefix("logs/").
+			TransitionAfter(30, types.TransitionStorageClassStandardIa).
+			TransitionAfter(90, types.TransitionStorageClassGlacier).
+			ExpireAfter(365),
+		*s3action.NewLifecycleRule("old-versions").
+			ExpireNoncurrentAfter(30, 3).
+			AbortIncompleteMultipartAfter(7),
+	}
+}
+
+func (s *LifecycleSuite) Test01ValidateRules() {
+	s.Empty(s3action.ValidateLifecycleRules(s.rules()))
+
+	bad := []s3action.LifecycleRule{
+		*s3action.NewLifecycleRule("too-early").TransitionAfter(10, types.TransitionStorageClassStandardIa),
+		*s3action.NewLifecycleRule("too-early").WithPrefix("tmp/"),
+		*s3action.NewLifecycleRule("late-transition").ExpireAfter(30).TransitionAfter(60, types.TransitionStorageClassGlacier),
+	}
+	issues := s3action.ValidateLifecycleRules(bad)
+	for _, issue := range issues {
+		log.Infof("issue: %v", issue)
+	}
+	s.Len(issues, 5)
+
+	overlapping := []s3action.LifecycleRule{
+		*s3action.NewLifecycleRule("all").ExpireAfter(90),
+		*s3action.NewLifecycleRule("logs").WithPrefix("logs/").ExpireAfter(30),
+		*s3action.NewLifecycleRule("images").WithPrefix("images/").ExpireAfter(10),
+	}
+	issues = s3action.ValidateLifecycleRules(overlapping)
+	s.Len(issues, 2)
+	for _, issue := range issues {
+		s.Equal(s3action.IssueWarning, issue.Level)
+	}
+}
+
+func (s *LifecycleSuite) Test02PutBucketLifecycle() {
+	err := s.S3Action.PutBucketLifecycle(s.BucketName, s.rules())
+	s.NoError(err)
+}
+
+func (s *LifecycleSuite) Test03GetBucketLifecycle() {
+	rules, err := s.S3Action.GetBucketLifecycle(s.BucketName)
+	s.NoError(err)
+	for _, rule := range rules {
+		log.Infof("rule: %+v", rule)
+	}
+}
+
+func (s *LifecycleSuite) Test04DeleteBucketLifecycle() {
+	err := s.S3Action.DeleteBucketLifecycle(s.BucketName)
+	s.NoError(err)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"s3-demo/core/s3action"
+)
+
+// Usage: go run ./examples/example10_diff -bucket b -key k -from v1 -to v2
+func main() {
+	bucketName := flag.String("bucket", "", "bucket name")
+	key := flag.String("key", "", "object key")
+	fromVersion := flag.String("from", "", "old version id")
+	toVersion := flag.String("to", "", "new version id")
+	flag.Parse()
+	if *bucketName == "" || *key == "" || *fromVersion == "" || *toVersion == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	s3Action := s3action.NewS3Client()
+	diff, err := s3Action.DiffVersions(*bucketName, *key, *fromVersion, *toVersion)
+	if err != nil {
+		log.Fatalf("diff versions err: %v", err)
+	}
+	fmt.Print(diff)
+	if !diff.Identical() {
+		os.Exit(1)
+	}
+}
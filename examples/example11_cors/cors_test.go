@@ -0,0 +1,80 @@
+package example11cors
+
+import (
+	"testing"
+
+	"s3-demo/core/s3action"
+	"s3-demo/log"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CORSSuite struct {
+	suite.Suite
+	S3Action   *s3action.S3Base
+	BucketName string
+}
+
+func TestCORSSuite(t *testing.T) {
+	suite.Run(t, new(CORSSuite))
+}
+
+func (s *CORSSuite) SetupSuite() {
+	s.S3Action = s3action.NewS3Client()
+	s.BucketName = "yuki-testobject-2022-12"
+}
+
+func (s *CORSSuite) rules() []s3action.CORSRule {
+	return []s3action.CORSRule{
+		*s3action.BrowserUploadRule("https://app.example.com", "https://*.example.com").WithID("upload"),
+		*s3action.NewCORSRule("*").AllowMethods("GET", "HEAD").WithID("public-read"),
+	}
+}
+
+func (s *CORSSuite) Test01ValidateRules() {
+	s.NoError(s3action.ValidateCORSRules(s.rules()))
+	s.Error(s3action.ValidateCORSRules([]s3action.CORSRule{*s3action.NewCORSRule("*").AllowMethods("PATCH")}))
+	s.Error(s3action.ValidateCORSRules([]s3action.CORSRule{*s3action.NewCORSRule("https://*.*.com").AllowMethods("GET")}))
+}
+
+func (s *CORSSuite) Test02EvaluatePreflight() {
+	result := s3action.EvaluateCORSPreflight(s.rules(), s3action.PreflightRequest{
+		Origin:  "https://admin.example.com",
+		Method:  "PUT",
+		Headers: []string{"Content-Type", "x-amz-meta-owner"},
+	})
+	s.True(result.Allowed)
+	s.Equal(0, result.RuleIndex)
+	s.Equal("https://admin.example.com", result.AllowOrigin)
+	s.Equal([]string{"ETag"}, result.ExposeHeaders)
+
+	result = s3action.EvaluateCORSPreflight(s.rules(), s3action.PreflightRequest{
+		Origin: "https://evil.test",
+		Method: "GET",
+	})
+	s.True(result.Allowed)
+	s.Equal("*", result.AllowOrigin)
+
+	result = s3action.EvaluateCORSPreflight(s.rules(), s3action.PreflightRequest{
+		Origin: "https://evil.test",
+		Method: "PUT",
+	})
+	s.False(result.Allowed)
+	for _, trace := range result.Trace {
+		log.Infof("rule %v (%v): %v", trace.Index, trace.ID, trace.Reason)
+	}
+}
+
+func (s *CORSSuite) Test03PutBucketCors() {
+	err := s.S3Action.PutBucketCors(s.BucketName, s.rules())
+	s.NoError(err)
+	rules, err := s.S3Action.GetBucketCors(s.BucketName)
+	if s.NoError(err) {
+		s.Len(rules, 2)
+	}
+}
+
+func (s *CORSSuite) Test04DeleteBucketCors() {
+	err := s.S3Action.DeleteBucketCors(s.BucketName)
+	s.NoError(err)
+}
@@ -0,0 +1,99 @@
+package example12website
+
+import (
+	"context"
+	"testing"
+
+	"s3-demo/core/s3action"
+	"s3-demo/log"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/suite"
+)
+
+type WebsiteSuite struct {
+	suite.Suite
+	S3Action   *s3action.S3Base
+	BucketName string
+}
+
+func TestWebsiteSuite(t *testing.T) {
+	suite.Run(t, new(WebsiteSuite))
+}
+
+func (s *WebsiteSuite) SetupSuite() {
+	s.S3Action = s3action.NewS3Client()
+	s.BucketName = "yuki-testobject-2022-12"
+}
+
+func (s *WebsiteSuite) Test01CacheControl() {
+	s.Equal("no-cache", s3action.DefaultCacheControl("index.html"))
+	s.Equal("public, max-age=31536000, immutable", s3action.DefaultCacheControl("assets/app.7d41e0aa.js"))
+	s.Equal("public, max-age=31536000, immutable", s3action.DefaultCacheControl("assets/index-B2xk9QzL.css"))
+	s.Equal("public, max-age=3600", s3action.DefaultCacheControl("assets/template.js"))
+	s.Equal("public, max-age=3600", s3action.DefaultCacheControl("robots.txt"))
+	s.Equal("public, max-age=3600", s3action.DefaultCacheControl("photos/photo-20221201.jpg"))
+	s.Equal("public, max-age=3600", s3action.DefaultCacheControl("img/avatar-default1.png"))
+	s.Equal("public, max-age=3600", s3action.DefaultCacheControl("docs/release.v2final.pdf"))
+	s.Equal("public, max-age=3600", s3action.DefaultCacheControl("assets/vendor.BUNDLE01.js"))
+}
+
+func (s *WebsiteSuite) Test02ValidateConfig() {
+	s.NoError(s3action.SPAWebsite().Validate())
+	config := s3action.SPAWebsite()
+	config.RoutingRules = []s3action.RoutingRule{{KeyPrefixEquals: "docs/"}}
+	s.Error(config.Validate())
+	s.Error(s3action.WebsiteConfig{
+		IndexDocument: "index.html",
+		RedirectAll:   &s3action.RedirectAllRequestsTo{HostName: "www.example.com"},
+	}.Validate())
+}
+
+func (s *WebsiteSuite) Test03PutBucketWebsite() {
+	config := s3action.SPAWebsite()
+	config.RoutingRules = []s3action.RoutingRule{{
+		KeyPrefixEquals:      "docs/",
+		ReplaceKeyPrefixWith: "documents/",
+		HttpRedirectCode:     "301",
+		Protocol:             types.ProtocolHttps,
+	}}
+	err := s.S3Action.PutBucketWebsite(s.BucketName, config)
+	s.NoError(err)
+
+	website, err := s.S3Action.GetBucketWebsite(s.BucketName)
+	if s.NoError(err) && s.NotNil(website) {
+		s.Equal("index.html", website.IndexDocument)
+		s.Len(website.RoutingRules, 1)
+	}
+}
+
+func (s *WebsiteSuite) Test04DeployWebsite() {
+	// Start from an empty prefix so the first deploy uploads every file.
+	existing, err := s.S3Action.GetObjectListByPrefix(s.BucketName, "site/")
+	if !s.NoError(err) {
+		return
+	}
+	if len(existing) > 0 && !s.NoError(s.S3Action.DeleteObjectList(s.BucketName, existing)) {
+		return
+	}
+
+	report, err := s.S3Action.DeployWebsite(context.TODO(), s.BucketName, "site", s3action.DeployOptions{
+		Prefix:      "site",
+		DeleteStale: true,
+		MaxParallel: 4,
+	})
+	if s.NoError(err) && s.NotEmpty(report.Uploaded) {
+		s.Equal("site/index.html", report.Uploaded[len(report.Uploaded)-1])
+		log.Infof("uploaded: %v, skipped: %v, deleted: %v", report.Uploaded, report.Skipped, report.Deleted)
+	}
+
+	report, err = s.S3Action.DeployWebsite(context.TODO(), s.BucketName, "site", s3action.DeployOptions{Prefix: "site"})
+	if s.NoError(err) {
+		s.Empty(report.Uploaded)
+	}
+}
+
+func (s *WebsiteSuite) Test05DeleteBucketWebsite() {
+	err := s.S3Action.DeleteBucketWebsite(s.BucketName)
+	s.NoError(err)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"s3-demo/core/s3action"
+)
+
+// Usage: go run ./examples/example13_deploy -bucket b -dir ./dist [-prefix p] [-delete] [-dry-run]
+func main() {
+	bucketName := flag.String("bucket", "", "bucket name")
+	dir := flag.String("dir", "", "build directory to deploy")
+	prefix := flag.String("prefix", "", "key prefix to deploy under")
+	deleteStale := flag.Bool("delete", false, "remove objects that are not in the build directory")
+	dryRun := flag.Bool("dry-run", false, "only report what would change")
+	parallel := flag.Int("parallel", 8, "concurrent uploads")
+	flag.Parse()
+	if *bucketName == "" || *dir == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	s3Action := s3action.NewS3Client()
+	report, err := s3Action.DeployWebsite(context.TODO(), *bucketName, *dir, s3action.DeployOptions{
+		Prefix:      *prefix,
+		DeleteStale: *deleteStale,
+		DryRun:      *dryRun,
+		MaxParallel: *parallel,
+	})
+	if err != nil {
+		log.Fatalf("deploy err: %v", err)
+	}
+	for _, key := range report.Uploaded {
+		log.Printf("\tupload %v\n", key)
+	}
+	for _, key := range report.Deleted {
+		log.Printf("\tdelete %v\n", key)
+	}
+	log.Printf("%d uploaded, %d unchanged, %d deleted\n", len(report.Uploaded), len(report.Skipped), len(report.Deleted))
+}
@@ -0,0 +1,131 @@
+package example14notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"s3-demo/core/s3action"
+	"s3-demo/log"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type NotificationSuite struct {
+	suite.Suite
+	S3Action   *s3action.S3Base
+	BucketName string
+	QueueArn   string
+	// LiveQueue is set when QueueArn names a real queue that allows the
+	// bucket to send messages, so the configuration can be put.
+	LiveQueue bool
+}
+
+func TestNotificationSuite(t *testing.T) {
+	suite.Run(t, new(NotificationSuite))
+}
+
+func (s *NotificationSuite) SetupSuite() {
+	s.S3Action = s3action.NewS3Client()
+	s.BucketName = "yuki-testobject-2022-12"
+	s.QueueArn = "arn:aws:sqs:us-west-2:111122223333:yuki-s3-events"
+	if queueArn := os.Getenv("S3_DEMO_QUEUE_ARN"); queueArn != "" {
+		s.QueueArn, s.LiveQueue = queueArn, true
+	}
+}
+
+func (s *NotificationSuite) config() s3action.NotificationConfig {
+	return s3action.NotificationConfig{Targets: []s3action.NotificationTarget{
+		*s3action.QueueNotification(s.QueueArn, s3action.EventObjectCreated, s3action.EventObjectRemoved).
+			WithID("uploads").
+			WithPrefix("uploads/").
+			WithSuffix(".csv"),
+	}}
+}
+
+func (s *NotificationSuite) Test01ValidateConfig() {
+	s.NoError(s3action.ValidateNotificationConfig(s.config()))
+
+	overlapping := s.config()
+	overlapping.Targets = append(overlapping.Targets,
+		*s3action.TopicNotification("arn:aws:sns:us-west-2:111122223333:yuki", s3action.EventObjectCreatedPut).WithPrefix("uploads/2022/"))
+	s.Error(s3action.ValidateNotificationConfig(overlapping))
+
+	disjoint := s.config()
+	disjoint.Targets = append(disjoint.Targets,
+		*s3action.TopicNotification("arn:aws:sns:us-west-2:111122223333:yuki", s3action.EventObjectCreatedPut).WithPrefix("images/"))
+	s.NoError(s3action.ValidateNotificationConfig(disjoint))
+}
+
+func (s *NotificationSuite) Test02ParseEvent() {
+	data, err := os.ReadFile("event.json")
+	s.Require().NoError(err)
+
+	event, err := s3action.ParseS3Event(data)
+	s.Require().NoError(err)
+	s.Require().Len(event.Records, 2)
+	record := event.Records[0]
+	s.Equal(s3action.EventObjectCreatedPut, record.Type())
+	s.Equal("uploads/monthly report(2022).csv", record.S3.Object.Key)
+	s.Equal(int64(1024), record.S3.Object.Size)
+	s.Equal(2022, record.EventTime.Year())
+
+	wrapped, err := json.Marshal(map[string]string{"Type": "Notification", "Message": string(data)})
+	s.Require().NoError(err)
+	event, err = s3action.ParseS3Event(wrapped)
+	if s.NoError(err) {
+		s.Len(event.Records, 2)
+	}
+
+	event, err = s3action.ParseS3Event([]byte(`{"Service":"Amazon S3","Event":"s3:TestEvent","Bucket":"yuki-testobject-2022-12"}`))
+	if s.NoError(err) {
+		s.True(event.TestEvent)
+	}
+	_, err = s3action.ParseS3Event([]byte(`{"hello":"world"}`))
+	s.Error(err)
+	_, err = s3action.ParseS3Event([]byte(`{"Records":null}`))
+	s.Error(err)
+}
+
+func (s *NotificationSuite) Test03Dispatch() {
+	data, err := os.ReadFile("event.json")
+	s.Require().NoError(err)
+
+	var created, removed []string
+	failed := errors.New("handler failed")
+	dispatcher := s3action.NewEventDispatcher().
+		Handle(s3action.EventObjectCreated, func(ctx context.Context, record s3action.S3EventRecord) error {
+			created = append(created, record.S3.Object.Key)
+			return nil
+		}).
+		Handle(s3action.EventObjectRemovedDeleteMarker, func(ctx context.Context, record s3action.S3EventRecord) error {
+			removed = append(removed, record.S3.Object.Key)
+			return failed
+		})
+	err = dispatcher.DispatchJSON(context.TODO(), data)
+	s.ErrorIs(err, failed)
+	s.Equal([]string{"uploads/monthly report(2022).csv"}, created)
+	s.Equal([]string{"uploads/old.csv"}, removed)
+}
+
+func (s *NotificationSuite) Test04PutBucketNotifications() {
+	if !s.LiveQueue {
+		s.T().Skip("S3_DEMO_QUEUE_ARN is not set; S3 rejects configurations whose queue it can't send to")
+	}
+	err := s.S3Action.PutBucketNotifications(s.BucketName, s.config())
+	s.NoError(err)
+
+	config, err := s.S3Action.GetBucketNotifications(s.BucketName)
+	if s.NoError(err) {
+		for _, t := range config.Targets {
+			log.Infof("%v %v %v prefix=%v suffix=%v", t.Type, t.Arn, t.Events, t.Prefix, t.Suffix)
+		}
+	}
+}
+
+func (s *NotificationSuite) Test05DeleteBucketNotifications() {
+	err := s.S3Action.DeleteBucketNotifications(s.BucketName)
+	s.NoError(err)
+}
@@ -8,6 +8,7 @@ require (
 	github.com/aws/aws-sdk-go-v2/feature/s3/manager v1.11.43
 	github.com/aws/aws-sdk-go-v2/service/s3 v1.29.5
 	github.com/aws/smithy-go v1.13.5
+	github.com/klauspost/compress v1.15.15
 	github.com/stretchr/testify v1.8.1
 )
 